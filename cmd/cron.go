@@ -0,0 +1,138 @@
+package cmd
+
+import (
+	"bytes"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// cronCmd represents the cron command
+var cronCmd = &cobra.Command{
+	Use:   "cron",
+	Short: "定时任务相关命令",
+	Long:  `定时任务相关命令, 定时任务按 cron 表达式定期创建任务`,
+}
+
+var cronCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "创建一个定时任务",
+	Long:  `创建一个定时任务`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("不能读取文件: %v", filename)
+		}
+
+		url := fmt.Sprintf("http://%s/crontasks", manager)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var c task.CronTask
+		err = json.Unmarshal(body, &c)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("创建定时任务 %s, 下次运行时间: %v\n", c.ID, c.NextScheduleTime)
+	},
+}
+
+var cronStatusCmd = &cobra.Command{
+	Use:   "status [ID]",
+	Short: "查看定时任务列表或者定时任务运行记录",
+	Long:  `不指定 ID 时列出所有定时任务, 指定 ID 时查看该定时任务的运行记录和错过的运行`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+
+		url := fmt.Sprintf("http://%s/crontasks", manager)
+		if len(args) == 1 {
+			url = fmt.Sprintf("%s/%s", url, args[0])
+		}
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		if len(args) == 0 {
+			var cronTasks []task.CronTask
+			if err := json.Unmarshal(body, &cronTasks); err != nil {
+				log.Fatal(err)
+			}
+			_, _ = fmt.Fprintln(w, "CronTask ID\tNAME\tSCHEDULE\tTIMEZONE\tPOLICY\tACTIVE\tLAST SCHEDULE\tNEXT SCHEDULE\tMISSED")
+			for _, c := range cronTasks {
+				tz := c.TimeZone
+				if tz == "" {
+					tz = "UTC"
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\t%d\n", c.ID, c.Name, c.Schedule, tz,
+					c.ConcurrencyPolicy, len(c.Active), formatTime(c.LastScheduleTime), formatTime(c.NextScheduleTime), c.MissedRunCount)
+			}
+			_ = w.Flush()
+			return
+		}
+
+		var c task.CronTask
+		if err := json.Unmarshal(body, &c); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("CronTask: %s (%s)\nSchedule: %s\nNext Schedule: %s\n\n", c.Name, c.ID, c.Schedule, formatTime(c.NextScheduleTime))
+		_, _ = fmt.Fprintln(w, "Task ID\tSCHEDULED\tSTATUS\tFINISHED")
+		for _, r := range append(c.History, c.Active...) {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.TaskID, formatTime(r.ScheduledTime), r.State, formatTime(r.FinishTime))
+		}
+		_ = w.Flush()
+
+		if c.MissedRunCount > 0 {
+			fmt.Printf("\nMissed Runs (%d):\n", c.MissedRunCount)
+			for _, t := range c.MissedRuns {
+				fmt.Printf("  %s\n", formatTime(t))
+			}
+		}
+	},
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "<none>"
+	}
+	return t.Format(time.DateTime + " MST")
+}
+
+func init() {
+	rootCmd.AddCommand(cronCmd)
+	cronCmd.AddCommand(cronCreateCmd)
+	cronCmd.AddCommand(cronStatusCmd)
+
+	cronCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	cronCreateCmd.Flags().StringP("filename", "f", "crontask.json", "定时任务文件")
+}
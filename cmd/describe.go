@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+)
+
+// describeCmd represents the describe command
+var describeCmd = &cobra.Command{
+	Use:   "describe",
+	Short: "查看对象详情",
+	Long:  `允许用户查看任务等对象的详细信息`,
+}
+
+var describeTaskCmd = &cobra.Command{
+	Use:   "task ID",
+	Short: "查看任务详情",
+	Long:  `查看任务详情, 包括任务无法调度时各节点未通过过滤的原因`,
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+
+		url := fmt.Sprintf("http://%s/tasks/%s", manager, args[0])
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var t task.Task
+		err = json.Unmarshal(body, &t)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintf(w, "ID:\t%s\n", t.ID)
+		_, _ = fmt.Fprintf(w, "Name:\t%s\n", t.Name)
+		_, _ = fmt.Fprintf(w, "Image:\t%s\n", t.Image)
+		_, _ = fmt.Fprintf(w, "State:\t%s\n", t.State)
+		_, _ = fmt.Fprintf(w, "Reason:\t%s\n", t.Reason)
+		_, _ = fmt.Fprintf(w, "Node:\t%s\n", t.Node)
+		_, _ = fmt.Fprintf(w, "Priority:\t%d\n", t.Priority)
+		_, _ = fmt.Fprintf(w, "Labels:\t%s\n", formatLabels(t.Labels))
+		_, _ = fmt.Fprintf(w, "Annotations:\t%s\n", formatLabels(t.Annotations))
+		_, _ = fmt.Fprintf(w, "Container ID:\t%s\n", t.ContainerID)
+		_, _ = fmt.Fprintf(w, "Restart Count:\t%d\n", t.RestartCount)
+		_ = w.Flush()
+
+		if len(t.SchedulingErrors) > 0 {
+			fmt.Println("Scheduling Errors:")
+			names := make([]string, 0, len(t.SchedulingErrors))
+			for name := range t.SchedulingErrors {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			for _, name := range names {
+				_, _ = fmt.Fprintf(w, "  %s\t%s\n", name, t.SchedulingErrors[name])
+			}
+			_ = w.Flush()
+		}
+
+		if len(t.Transitions) > 0 {
+			fmt.Println("Transitions:")
+			w = tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "  TIME\tFROM\tTO\tREASON")
+			for _, tr := range t.Transitions {
+				_, _ = fmt.Fprintf(w, "  %s\t%s\t%s\t%s\n", tr.Time.Local().Format(time.DateTime), tr.From, tr.To, tr.Reason)
+			}
+			_ = w.Flush()
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(describeCmd)
+	describeCmd.AddCommand(describeTaskCmd)
+
+	describeCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "manager 地址")
+}
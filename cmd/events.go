@@ -0,0 +1,121 @@
+package cmd
+
+import (
+	"cube/manager"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// eventsCmd represents the events command
+var eventsCmd = &cobra.Command{
+	Use:   "events",
+	Short: "查看集群事件",
+	Long: `查看任务提交, 调度, 启动, 失败, 重启以及节点失联等集群事件,
+可以按任务, 节点, 事件类型和时间过滤, --watch 持续输出新事件`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		taskID, _ := cmd.Flags().GetString("task")
+		nodeName, _ := cmd.Flags().GetString("node")
+		types, _ := cmd.Flags().GetStringSlice("type")
+		since, _ := cmd.Flags().GetDuration("since")
+		watch, _ := cmd.Flags().GetBool("watch")
+
+		q := url.Values{}
+		if taskID != "" {
+			q.Set("task", taskID)
+		}
+		if nodeName != "" {
+			q.Set("node", nodeName)
+		}
+		if len(types) > 0 {
+			q.Set("type", strings.Join(types, ","))
+		}
+		if since > 0 {
+			q.Set("since", time.Now().Add(-since).UTC().Format(time.RFC3339))
+		}
+
+		// watch 时逐行输出, 使用固定列宽对齐
+		if watch {
+			q.Set("watch", "true")
+			fmt.Printf(watchEventFormat, "TIME", "TYPE", "REASON", "TASK ID", "NODE", "MESSAGE")
+			watchSSE(fmt.Sprintf("http://%s/events?%s", managerAddr, q.Encode()), func(event string, data []byte) {
+				if event == manager.WatchError {
+					var errResp manager.ErrResponse
+					_ = json.Unmarshal(data, &errResp)
+					fmt.Printf("%s, 从最早保留的事件重新读取\n", errResp.Message)
+					return
+				}
+				var e task.ClusterEvent
+				if err := json.Unmarshal(data, &e); err != nil {
+					log.Printf("json 解码失败: %v\n", err)
+					return
+				}
+				fmt.Printf(watchEventFormat, eventColumns(e)...)
+			})
+			return
+		}
+
+		resp, err := http.Get(fmt.Sprintf("http://%s/events?%s", managerAddr, q.Encode()))
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var events []task.ClusterEvent
+		if err := json.Unmarshal(body, &events); err != nil {
+			log.Fatal(err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 3, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TIME\tTYPE\tREASON\tTASK ID\tNODE\tMESSAGE")
+		for _, e := range events {
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", eventColumns(e)...)
+		}
+		_ = w.Flush()
+	},
+}
+
+const watchEventFormat = "%-25s %-19s %-24s %-38s %-17s %s\n"
+
+func eventColumns(e task.ClusterEvent) []any {
+	taskID := "-"
+	if e.TaskID != uuid.Nil {
+		taskID = e.TaskID.String()
+	}
+	return []any{formatTime(e.Time.Local()), e.Type, orDash(e.Reason), taskID, orDash(e.Node), e.Message}
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+func init() {
+	rootCmd.AddCommand(eventsCmd)
+
+	eventsCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	eventsCmd.Flags().String("task", "", "只显示指定任务的事件")
+	eventsCmd.Flags().String("node", "", "只显示指定节点的事件")
+	eventsCmd.Flags().StringSlice("type", nil, "只显示指定类型的事件, 例如 TaskFailed,NodeNotReady")
+	eventsCmd.Flags().Duration("since", 0, "只显示最近一段时间内的事件, 例如 1h")
+	eventsCmd.Flags().BoolP("watch", "w", false, "持续输出新事件")
+}
@@ -1,9 +1,15 @@
 package cmd
 
 import (
+	"context"
+	"cube/logging"
 	"cube/manager"
+	"cube/tracing"
+	"fmt"
 	"github.com/spf13/cobra"
 	"log"
+	"log/slog"
+	"os"
 )
 
 // managerCmd represents the manager command
@@ -21,15 +27,30 @@ var managerCmd = &cobra.Command{
 		workers, _ := cmd.Flags().GetStringSlice("workers")
 		scheduler, _ := cmd.Flags().GetString("scheduler")
 		dbType, _ := cmd.Flags().GetString("db-type")
+		preemption, _ := cmd.Flags().GetBool("preemption")
 
-		log.Println("启动 manager")
-		m := manager.New(workers, scheduler, dbType)
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		if err := logging.Setup(os.Stderr, logLevel, logFormat); err != nil {
+			log.Fatal(err)
+		}
+		traceExporter, _ := cmd.Flags().GetString("trace-exporter")
+		traceEndpoint, _ := cmd.Flags().GetString("trace-endpoint")
+		shutdown, err := tracing.Setup("cube-manager", traceExporter, traceEndpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() { _ = shutdown(context.Background()) }()
+
+		slog.Info("启动 manager")
+		m := manager.New(workers, scheduler, dbType, preemption)
 		api := manager.Api{Address: host, Port: port, Manager: m}
 
+		go m.CollectStats()
 		go m.ProcessTasks()
 		go m.UpdateTasks()
-		//go m.DoHealthChecks()
-		log.Printf("manager API: http://%s:%d\n", host, port)
+		go m.DoHealthChecks()
+		slog.Info("manager API", "address", fmt.Sprintf("http://%s:%d", host, port))
 		api.Start()
 	},
 }
@@ -41,6 +62,11 @@ func init() {
 	managerCmd.Flags().IntP("port", "p", 5555, "监听端口")
 
 	managerCmd.Flags().StringSliceP("workers", "w", []string{"localhost:5556"}, "worker 节点列表")
-	managerCmd.Flags().StringP("scheduler", "s", "e_pvm", "调度方式: round_robin 或者 e_pvm")
+	managerCmd.Flags().StringP("scheduler", "s", "e_pvm", "调度方式: round_robin, e_pvm 或者 bin_packing")
 	managerCmd.Flags().StringP("db-type", "d", "memory", "存储数据类型: memory 或者 persistent")
+	managerCmd.Flags().Bool("preemption", false, "没有节点满足条件时, 驱逐低优先级任务为高优先级任务腾出资源")
+	managerCmd.Flags().String("log-level", "info", "日志级别: debug, info, warn 或者 error")
+	managerCmd.Flags().String("log-format", "text", "日志格式: text 或者 json")
+	managerCmd.Flags().String("trace-exporter", "none", "trace 导出方式: none, otlp 或者 file")
+	managerCmd.Flags().String("trace-endpoint", "localhost:4318", "OTLP/HTTP 接收地址, 导出方式为 file 时为文件路径")
 }
@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"bytes"
 	"cube/node"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,8 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 )
 
@@ -38,16 +41,132 @@ var nodeCmd = &cobra.Command{
 		}
 
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
-		_, _ = fmt.Fprintln(w, "NAME\tMEMORY(MB)\tDISK(GB)\tROLE\tTASKS\t")
+		_, _ = fmt.Fprintln(w, "NAME\tSTATUS\tCPU(CORES)\tMEMORY(MB)\tDISK(GB)\tROLE\tTASKS\tLABELS\tTAINTS\t")
 		for _, n := range nodes {
-			_, _ = fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%d\n", n.Name, n.Memory/1000, n.Disk/1000/1000/1000, n.Role, n.TaskCount)
+			status := "Ready"
+			if n.Stale {
+				status = "NotReady"
+			}
+			if n.Unschedulable {
+				status += ",SchedulingDisabled"
+			}
+			// 已分配/总量
+			cpu := fmt.Sprintf("%.1f/%d", n.CpuAllocated, n.Cores)
+			memory := fmt.Sprintf("%d/%d", n.MemoryAllocated/1000, n.Memory/1000)
+			disk := fmt.Sprintf("%d/%d", n.DiskAllocated/1000/1000/1000, n.Disk/1000/1000/1000)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", n.Name, status, cpu, memory, disk, n.Role, n.TaskCount, formatLabels(n.Labels), formatTaints(n.Taints))
 		}
 		_ = w.Flush()
 	},
 }
 
+var nodeCordonCmd = &cobra.Command{
+	Use:   "cordon NAME",
+	Short: "禁止调度任务到节点",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		nodeRequest("POST", fmt.Sprintf("http://%s/nodes/%s/cordon", manager, args[0]), nil)
+		log.Printf("节点 %s 已禁止调度\n", args[0])
+	},
+}
+
+var nodeUncordonCmd = &cobra.Command{
+	Use:   "uncordon NAME",
+	Short: "恢复调度任务到节点",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		nodeRequest("POST", fmt.Sprintf("http://%s/nodes/%s/uncordon", manager, args[0]), nil)
+		log.Printf("节点 %s 已恢复调度\n", args[0])
+	},
+}
+
+var nodeDrainCmd = &cobra.Command{
+	Use:   "drain NAME",
+	Short: "禁止调度任务到节点, 并将节点上的任务迁移到其他节点",
+	Args:  cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		nodeRequest("POST", fmt.Sprintf("http://%s/nodes/%s/drain", manager, args[0]), nil)
+		log.Printf("节点 %s 开始驱逐任务\n", args[0])
+	},
+}
+
+var nodeTaintCmd = &cobra.Command{
+	Use:   "taint NAME key=value:Effect | key-",
+	Short: "添加或移除节点污点",
+	Long: `添加或移除节点污点, Effect 可选 NoSchedule 或 PreferNoSchedule。
+以 - 结尾表示移除该 key 的所有污点`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		if key, ok := strings.CutSuffix(args[1], "-"); ok {
+			nodeRequest("DELETE", fmt.Sprintf("http://%s/nodes/%s/taints/%s", manager, args[0], key), nil)
+			log.Printf("节点 %s 已移除污点 %s\n", args[0], key)
+			return
+		}
+
+		taint, err := node.ParseTaint(args[1])
+		if err != nil {
+			log.Fatal(err)
+		}
+		data, _ := json.Marshal(taint)
+		nodeRequest("POST", fmt.Sprintf("http://%s/nodes/%s/taints", manager, args[0]), data)
+		log.Printf("节点 %s 已添加污点 %s\n", args[0], taint)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(nodeCmd)
+	nodeCmd.AddCommand(nodeCordonCmd, nodeUncordonCmd, nodeDrainCmd, nodeTaintCmd)
+
+	nodeCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "manager 地址")
+}
+
+func nodeRequest(method string, url string, data []byte) {
+	req, err := http.NewRequest(method, url, bytes.NewBuffer(data))
+	if err != nil {
+		log.Fatalf("创建请求失败: %v, 错误: %v\n", url, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("连接失败: %v, 错误: %v\n", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+	}
+}
+
+func formatTaints(taints []node.Taint) string {
+	if len(taints) == 0 {
+		return "<none>"
+	}
+	s := make([]string, 0, len(taints))
+	for _, t := range taints {
+		s = append(s, t.String())
+	}
+	return strings.Join(s, ",")
+}
+
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "<none>"
+	}
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
 
-	nodeCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", k, labels[k]))
+	}
+	return strings.Join(pairs, ",")
 }
@@ -20,6 +20,11 @@ var runCmd = &cobra.Command{
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
 		filename, _ := cmd.Flags().GetString("filename")
+		gang, _ := cmd.Flags().GetBool("gang")
+		pod, _ := cmd.Flags().GetBool("pod")
+		if gang && pod {
+			log.Fatal("--gang 和 --pod 不能同时使用")
+		}
 		fullFilePath, err := filepath.Abs(filename)
 		if err != nil {
 			log.Fatal(err)
@@ -38,6 +43,12 @@ var runCmd = &cobra.Command{
 		log.Printf("内容: %s", string(data))
 
 		url := fmt.Sprintf("http://%s/tasks", manager)
+		if gang {
+			url = fmt.Sprintf("http://%s/gangs", manager)
+		}
+		if pod {
+			url = fmt.Sprintf("http://%s/pods", manager)
+		}
 		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
 			log.Fatal(err)
@@ -57,6 +68,8 @@ func init() {
 
 	runCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
 	runCmd.Flags().StringP("filename", "f", "task.json", "任务文件")
+	runCmd.Flags().Bool("gang", false, "文件内容为任务组, 所有成员同时调度")
+	runCmd.Flags().Bool("pod", false, "文件内容为 Pod, 所有成员调度到同一节点并共享网络和存储卷")
 }
 
 func fileExists(filename string) bool {
@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"bytes"
+	"cube/scheduler"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "调度相关命令",
+	Long:  `调度相关命令`,
+}
+
+var scheduleExplainCmd = &cobra.Command{
+	Use:   "explain",
+	Short: "试运行调度并解释结果",
+	Long:  `使用 manager 当前配置的调度算法对任务试运行一次调度, 输出各节点过滤结果, 评分明细和最终选择的节点, 不会下发任务`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("不能读取文件: %v", filename)
+		}
+
+		url := fmt.Sprintf("http://%s/schedule/explain", manager)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var e scheduler.Explanation
+		err = json.Unmarshal(body, &e)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		_, _ = fmt.Fprintln(w, "NODE\tFILTER\tSCORES\tTOTAL\t")
+		for _, n := range e.Nodes {
+			if !n.Passed {
+				_, _ = fmt.Fprintf(w, "%s\t%s\t-\t-\n", n.Name, n.Reason)
+				continue
+			}
+			_, _ = fmt.Fprintf(w, "%s\tpassed\t%s\t%.4f\n", n.Name, formatScores(n.Scores), n.Total)
+		}
+		_ = w.Flush()
+
+		if e.Pick == "" {
+			fmt.Println("\n没有节点满足任务")
+			return
+		}
+		fmt.Printf("\n选择节点: %s\n", e.Pick)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleExplainCmd)
+
+	scheduleCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	scheduleExplainCmd.Flags().StringP("filename", "f", "task.json", "任务文件")
+}
+
+func formatScores(scores map[string]float64) string {
+	keys := make([]string, 0, len(scores))
+	for k := range scores {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, k := range keys {
+		pairs = append(pairs, fmt.Sprintf("%s=%.4f", k, scores[k]))
+	}
+	return strings.Join(pairs, ",")
+}
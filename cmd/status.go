@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"cube/manager"
 	"cube/task"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"text/tabwriter"
 	"time"
@@ -18,12 +20,52 @@ import (
 var statusCmd = &cobra.Command{
 	Use:   "status",
 	Short: "查看任务列表",
-	Long:  `允许用户获取任务列表`,
+	Long: `允许用户获取任务列表, --selector 只列出标签匹配的任务,
+--watch 在输出任务列表后持续输出任务的变化`,
 	Run: func(cmd *cobra.Command, args []string) {
-		manager, _ := cmd.Flags().GetString("manager")
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		watch, _ := cmd.Flags().GetBool("watch")
+		selector, _ := cmd.Flags().GetString("selector")
 
-		url := fmt.Sprintf("http://%s/tasks", manager)
-		resp, err := http.Get(url)
+		// watch 时先以 ADDED 输出所有任务, 之后逐行输出变化, 使用固定列宽对齐
+		if watch {
+			fmt.Printf(watchTaskFormat, "EVENT", "Task ID", "NAME", "CREATED", "STATUS", "Container ID", "Image")
+			q := url.Values{"watch": {"true"}}
+			if selector != "" {
+				q.Set("labels", selector)
+			}
+			watchSSE(fmt.Sprintf("http://%s/tasks?%s", managerAddr, q.Encode()), func(event string, data []byte) {
+				if event == manager.WatchError {
+					var errResp manager.ErrResponse
+					_ = json.Unmarshal(data, &errResp)
+					fmt.Printf("%s, 重新读取任务列表\n", errResp.Message)
+					return
+				}
+				var e manager.WatchEvent
+				if err := json.Unmarshal(data, &e); err != nil {
+					log.Printf("json 解码失败: %v\n", err)
+					return
+				}
+				var t task.Task
+				if err := json.Unmarshal(e.Object, &t); err != nil {
+					log.Printf("json 解码失败: %v\n", err)
+					return
+				}
+				fmt.Printf(watchTaskFormat, append([]any{e.Type}, taskColumns(&t)...)...)
+			})
+			return
+		}
+
+		q := url.Values{}
+		if selector != "" {
+			q.Set("labels", selector)
+		}
+		for _, name := range []string{"state", "node", "sort", "order"} {
+			if v, _ := cmd.Flags().GetString(name); v != "" {
+				q.Set(name, v)
+			}
+		}
+		resp, err := http.Get(fmt.Sprintf("http://%s/tasks?%s", managerAddr, q.Encode()))
 		if err != nil {
 			log.Fatal(err)
 		}
@@ -32,6 +74,9 @@ var statusCmd = &cobra.Command{
 			log.Fatal(err)
 		}
 		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
 
 		var tasks []*task.Task
 		err = json.Unmarshal(body, &tasks)
@@ -42,22 +87,32 @@ var statusCmd = &cobra.Command{
 		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
 		_, _ = fmt.Fprintln(w, "Task ID\tNAME\tCREATED\tSTATUS\tContainer ID\tImage")
 		for _, t := range tasks {
-			var start string
-			if t.StartTime.IsZero() {
-				start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(time.Now().UTC())))
-			} else {
-				start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(t.StartTime)))
-			}
-
-			state := t.State.String()[t.State]
-			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, start, state, t.ContainerID, t.Image)
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", taskColumns(t)...)
 		}
 		_ = w.Flush()
 	},
 }
 
+const watchTaskFormat = "%-9s %-36s  %-20s  %-16s  %-13s  %-12.12s  %s\n"
+
+func taskColumns(t *task.Task) []any {
+	var start string
+	if t.StartTime.IsZero() {
+		start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(time.Now().UTC())))
+	} else {
+		start = fmt.Sprintf("%s ago", units.HumanDuration(time.Now().UTC().Sub(t.StartTime)))
+	}
+	return []any{t.ID, t.Name, start, t.State.String(), t.ContainerID, t.Image}
+}
+
 func init() {
 	rootCmd.AddCommand(statusCmd)
 
 	statusCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	statusCmd.Flags().BoolP("watch", "w", false, "持续输出任务的变化")
+	statusCmd.Flags().StringP("selector", "l", "", "标签选择器, 如 app=web,env!=prod")
+	statusCmd.Flags().String("state", "", "只列出指定状态的任务, 多个状态以逗号分隔")
+	statusCmd.Flags().String("node", "", "只列出运行在指定节点的任务")
+	statusCmd.Flags().String("sort", "", "排序字段: id, name, image, node, state, start")
+	statusCmd.Flags().String("order", "asc", "排序方向: asc 或者 desc")
 }
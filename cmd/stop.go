@@ -1,9 +1,13 @@
 package cmd
 
 import (
+	"cube/task"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"net/http"
+	"net/url"
 
 	"github.com/spf13/cobra"
 )
@@ -12,11 +16,24 @@ import (
 var stopCmd = &cobra.Command{
 	Use:   "stop",
 	Short: "停止一个新任务",
-	Long:  `停止一个新任务`,
+	Long:  `停止一个新任务, --selector 停止标签匹配的所有任务`,
 	Run: func(cmd *cobra.Command, args []string) {
 		manager, _ := cmd.Flags().GetString("manager")
+		pod, _ := cmd.Flags().GetBool("pod")
+		selector, _ := cmd.Flags().GetString("selector")
+
+		if selector != "" {
+			stopSelected(manager, selector)
+			return
+		}
+		if len(args) == 0 {
+			log.Fatal("需要指定任务 id 或者标签选择器")
+		}
 
 		url := fmt.Sprintf("http://%s/tasks/%s", manager, args[0])
+		if pod {
+			url = fmt.Sprintf("http://%s/pods/%s", manager, args[0])
+		}
 		client := &http.Client{}
 		req, err := http.NewRequest("DELETE", url, nil)
 		if err != nil {
@@ -37,8 +54,41 @@ var stopCmd = &cobra.Command{
 	},
 }
 
+func stopSelected(manager string, selector string) {
+	u := fmt.Sprintf("http://%s/tasks?%s", manager, url.Values{"labels": {selector}}.Encode())
+	req, err := http.NewRequest("DELETE", u, nil)
+	if err != nil {
+		log.Fatalf("创建请求失败: %v, 错误: %v\n", u, err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Fatalf("连接失败: %v, 错误: %v\n", u, err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+	}
+
+	var tasks []*task.Task
+	if err := json.Unmarshal(body, &tasks); err != nil {
+		log.Fatal(err)
+	}
+	for _, t := range tasks {
+		log.Printf("停止任务 %v (%s), 请求发送成功 !\n", t.ID, t.Name)
+	}
+	if len(tasks) == 0 {
+		log.Printf("没有标签匹配 %s 的运行中任务\n", selector)
+	}
+}
+
 func init() {
 	rootCmd.AddCommand(stopCmd)
 
 	stopCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	stopCmd.Flags().Bool("pod", false, "停止 Pod 的所有成员")
+	stopCmd.Flags().StringP("selector", "l", "", "标签选择器, 停止标签匹配的所有任务")
 }
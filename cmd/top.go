@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"cube/manager"
+	"encoding/json"
+	"fmt"
+	"github.com/docker/go-units"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"text/tabwriter"
+)
+
+// topCmd represents the top command
+var topCmd = &cobra.Command{
+	Use:   "top",
+	Short: "查看任务资源使用量",
+	Long:  `查看运行中任务最近一次采集的 CPU, 内存, 网络和块设备 IO 使用量, 按使用量从高到低排列`,
+	Run: func(cmd *cobra.Command, args []string) {
+		managerAddr, _ := cmd.Flags().GetString("manager")
+		sortBy, _ := cmd.Flags().GetString("sort")
+
+		url := fmt.Sprintf("http://%s/stats/tasks", managerAddr)
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var usage []manager.TaskUsage
+		if err := json.Unmarshal(body, &usage); err != nil {
+			log.Fatal(err)
+		}
+
+		var key func(manager.TaskUsage) float64
+		switch sortBy {
+		case "cpu":
+			key = func(u manager.TaskUsage) float64 { return u.Usage.Cpu }
+		case "memory":
+			key = func(u manager.TaskUsage) float64 { return float64(u.Usage.Memory) }
+		case "net":
+			key = func(u manager.TaskUsage) float64 { return float64(u.Usage.NetworkRx + u.Usage.NetworkTx) }
+		case "block":
+			key = func(u manager.TaskUsage) float64 { return float64(u.Usage.BlockRead + u.Usage.BlockWrite) }
+		default:
+			log.Fatalf("无效的排序字段: %s, 可选 cpu, memory, net 或者 block", sortBy)
+		}
+		sort.SliceStable(usage, func(i, j int) bool {
+			return key(usage[i]) > key(usage[j])
+		})
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		_, _ = fmt.Fprintln(w, "Task ID\tNAME\tNODE\tCPU(CORES)\tMEMORY\tMEM %\tNET I/O\tBLOCK I/O")
+		for _, u := range usage {
+			memPercent := "-"
+			if u.Usage.MemoryLimit > 0 {
+				memPercent = fmt.Sprintf("%.1f%%", 100*float64(u.Usage.Memory)/float64(u.Usage.MemoryLimit))
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%.3f\t%s\t%s\t%s / %s\t%s / %s\n", u.TaskID, u.Name, u.Node, u.Usage.Cpu,
+				units.BytesSize(float64(u.Usage.Memory)), memPercent,
+				units.HumanSize(float64(u.Usage.NetworkRx)), units.HumanSize(float64(u.Usage.NetworkTx)),
+				units.HumanSize(float64(u.Usage.BlockRead)), units.HumanSize(float64(u.Usage.BlockWrite)))
+		}
+		_ = w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(topCmd)
+
+	topCmd.Flags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	topCmd.Flags().String("sort", "cpu", "排序字段: cpu, memory, net 或者 block")
+}
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"bufio"
+	"cube/manager"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// watchSSE 读取 manager 以 Server-Sent Events 格式返回的事件流, 对每条消息调用 handle。
+// 连接断开后带上最后收到的消息 id (Last-Event-ID) 重新连接, 从断开处继续读取;
+// 收到 ERROR 消息 (断开处已不可读取) 时不带 id 重新连接, 从完整列表开始读取
+func watchSSE(url string, handle func(event string, data []byte)) {
+	var lastID string
+	for {
+		req, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			log.Printf("连接 manager 失败: %v, 1 秒后重试\n", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			log.Fatalf("请求错误: %v\n", resp.StatusCode)
+		}
+
+		var event, data string
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if data != "" {
+					handle(event, []byte(data))
+				}
+				if event == manager.WatchError {
+					lastID = ""
+				}
+				event, data = "", ""
+			case strings.HasPrefix(line, ":"):
+			case strings.HasPrefix(line, "id: "):
+				lastID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				event = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+		resp.Body.Close()
+		fmt.Println("连接已断开, 重新连接")
+		time.Sleep(time.Second)
+	}
+}
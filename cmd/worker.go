@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"context"
+	"cube/logging"
+	"cube/tracing"
 	"cube/worker"
 	"fmt"
 	"github.com/google/uuid"
 	"github.com/spf13/cobra"
 	"log"
+	"log/slog"
+	"os"
 )
 
 // workerCmd represents the worker command
@@ -18,15 +23,30 @@ var workerCmd = &cobra.Command{
 		port, _ := cmd.Flags().GetInt("port")
 		name, _ := cmd.Flags().GetString("name")
 		dbType, _ := cmd.Flags().GetString("db-type")
+		labels, _ := cmd.Flags().GetStringToString("labels")
+		retention, _ := cmd.Flags().GetDuration("retention")
 
-		log.Println("启动 worker")
-		w := worker.New(name, dbType)
+		logLevel, _ := cmd.Flags().GetString("log-level")
+		logFormat, _ := cmd.Flags().GetString("log-format")
+		if err := logging.Setup(os.Stderr, logLevel, logFormat); err != nil {
+			log.Fatal(err)
+		}
+		traceExporter, _ := cmd.Flags().GetString("trace-exporter")
+		traceEndpoint, _ := cmd.Flags().GetString("trace-endpoint")
+		shutdown, err := tracing.Setup("cube-worker", traceExporter, traceEndpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer func() { _ = shutdown(context.Background()) }()
+
+		slog.Info("启动 worker")
+		w := worker.New(name, dbType, labels, retention)
 		api := worker.Api{Address: host, Port: port, Worker: w}
 
 		go w.RunTasks()
 		go w.CollectionStats()
 		go w.UpdateTask()
-		log.Printf("worker API: http://%s:%d\n", host, port)
+		slog.Info("worker API", "address", fmt.Sprintf("http://%s:%d", host, port))
 		api.Start()
 	},
 }
@@ -39,4 +59,10 @@ func init() {
 
 	workerCmd.Flags().StringP("name", "n", fmt.Sprintf("worker-%s", uuid.New().String()), "worker 名称")
 	workerCmd.Flags().StringP("db-type", "d", "memory", "存储数据类型: memory 或者 persistent")
+	workerCmd.Flags().StringToStringP("labels", "l", nil, "节点标签, 例如 zone=a,rack=r1")
+	workerCmd.Flags().Duration("retention", 0, "任务结束后保留容器的时间, 例如 1h, 为 0 时立即移除")
+	workerCmd.Flags().String("log-level", "info", "日志级别: debug, info, warn 或者 error")
+	workerCmd.Flags().String("log-format", "text", "日志格式: text 或者 json")
+	workerCmd.Flags().String("trace-exporter", "none", "trace 导出方式: none, otlp 或者 file")
+	workerCmd.Flags().String("trace-endpoint", "localhost:4318", "OTLP/HTTP 接收地址, 导出方式为 file 时为文件路径")
 }
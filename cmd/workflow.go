@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bytes"
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"github.com/spf13/cobra"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// workflowCmd represents the workflow command
+var workflowCmd = &cobra.Command{
+	Use:   "workflow",
+	Short: "工作流相关命令",
+	Long:  `工作流相关命令, 工作流由步骤及其依赖组成, 步骤在所有上游步骤完成后才会运行`,
+}
+
+var workflowRunCmd = &cobra.Command{
+	Use:   "run",
+	Short: "运行一个新工作流",
+	Long:  `运行一个新工作流`,
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+		filename, _ := cmd.Flags().GetString("filename")
+
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			log.Fatalf("不能读取文件: %v", filename)
+		}
+
+		url := fmt.Sprintf("http://%s/workflows", manager)
+		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusCreated {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		var wf task.Workflow
+		err = json.Unmarshal(body, &wf)
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("创建工作流 %s, 请求发送成功 !\n", wf.ID)
+	},
+}
+
+var workflowStatusCmd = &cobra.Command{
+	Use:   "status [ID]",
+	Short: "查看工作流列表或者工作流各步骤状态",
+	Long:  `不指定 ID 时列出所有工作流, 指定 ID 时查看该工作流各步骤的状态`,
+	Args:  cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		manager, _ := cmd.Flags().GetString("manager")
+
+		url := fmt.Sprintf("http://%s/workflows", manager)
+		if len(args) == 1 {
+			url = fmt.Sprintf("%s/%s", url, args[0])
+		}
+		resp, err := http.Get(url)
+		if err != nil {
+			log.Fatal(err)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			log.Fatalf("请求错误: %v, %s\n", resp.StatusCode, body)
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 5, ' ', tabwriter.TabIndent)
+		if len(args) == 0 {
+			var workflows []task.Workflow
+			if err := json.Unmarshal(body, &workflows); err != nil {
+				log.Fatal(err)
+			}
+			_, _ = fmt.Fprintln(w, "Workflow ID\tNAME\tSTATUS\tSTEPS")
+			for _, wf := range workflows {
+				completed := 0
+				for _, s := range wf.Steps {
+					if s.State == task.Completed {
+						completed++
+					}
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\n", wf.ID, wf.Name, wf.State, completed, len(wf.Steps))
+			}
+			_ = w.Flush()
+			return
+		}
+
+		var wf task.Workflow
+		if err := json.Unmarshal(body, &wf); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Workflow: %s (%s)\nState: %s\n\n", wf.Name, wf.ID, wf.State)
+		_, _ = fmt.Fprintln(w, "STEP\tDEPENDS ON\tSTATUS\tATTEMPTS\tTask ID\tREASON")
+		for _, s := range wf.Steps {
+			deps := "<none>"
+			if len(s.DependsOn) > 0 {
+				deps = strings.Join(s.DependsOn, ",")
+			}
+			taskID := "<none>"
+			if len(s.TaskIDs) > 0 {
+				taskID = s.TaskIDs[len(s.TaskIDs)-1].String()
+			}
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%d/%d\t%s\t%s\n", s.Name, deps, s.State, len(s.TaskIDs), s.Retries+1, taskID, s.Reason)
+		}
+		_ = w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(workflowCmd)
+	workflowCmd.AddCommand(workflowRunCmd)
+	workflowCmd.AddCommand(workflowStatusCmd)
+
+	workflowCmd.PersistentFlags().StringP("manager", "m", "localhost:5555", "manager 地址")
+	workflowRunCmd.Flags().StringP("filename", "f", "workflow.json", "工作流文件")
+}
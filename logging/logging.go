@@ -0,0 +1,84 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync/atomic"
+)
+
+var (
+	level   = new(slog.LevelVar)
+	current atomic.Pointer[slog.Handler]
+)
+
+func init() {
+	var h slog.Handler = slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: level})
+	current.Store(&h)
+}
+
+// Setup 设置日志级别 (debug, info, warn, error) 和输出格式 (text, json), 在启动 manager 或 worker 之前调用
+func Setup(w io.Writer, levelName string, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(levelName)); err != nil {
+		return fmt.Errorf("无效的日志级别: %s", levelName)
+	}
+	level.Set(l)
+
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(w, opts)
+	case "json":
+		h = slog.NewJSONHandler(w, opts)
+	default:
+		return fmt.Errorf("无效的日志格式: %s, 可选 text 或者 json", format)
+	}
+	current.Store(&h)
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// Component 返回带有 component 字段的 logger, 可以在包初始化时创建, 之后调用 Setup 仍然生效
+func Component(name string) *slog.Logger {
+	return slog.New(&handler{}).With("component", name)
+}
+
+// handler 将日志转发给 Setup 设置的 handler, 并保留 With 和 WithGroup 添加的字段
+type handler struct {
+	wrap []func(slog.Handler) slog.Handler
+}
+
+func (h *handler) resolve() slog.Handler {
+	r := *current.Load()
+	for _, f := range h.wrap {
+		r = f(r)
+	}
+	return r
+}
+
+func (h *handler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= level.Level()
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	return h.resolve().Handle(ctx, r)
+}
+
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return h.with(func(r slog.Handler) slog.Handler { return r.WithAttrs(attrs) })
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return h.with(func(r slog.Handler) slog.Handler { return r.WithGroup(name) })
+}
+
+func (h *handler) with(f func(slog.Handler) slog.Handler) slog.Handler {
+	wrap := make([]func(slog.Handler) slog.Handler, len(h.wrap), len(h.wrap)+1)
+	copy(wrap, h.wrap)
+	return &handler{wrap: append(wrap, f)}
+}
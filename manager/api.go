@@ -1,6 +1,7 @@
 package manager
 
 import (
+	"cube/tracing"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -23,16 +24,59 @@ func (a *Api) initRouter() {
 	a.Router.Route("/tasks", func(r chi.Router) {
 		r.Post("/", a.StartTaskHandler)
 		r.Get("/", a.GetTaskHandler)
+		r.Delete("/", a.StopTasksHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
+			r.Get("/", a.GetTaskByIDHandler)
 			r.Delete("/", a.StopTaskHandler)
+			r.Get("/stats", a.GetTaskStatsHandler)
 		})
 	})
+	a.Router.Route("/gangs", func(r chi.Router) {
+		r.Post("/", a.StartGangHandler)
+		r.Get("/", a.GetGangsHandler)
+	})
+	a.Router.Route("/pods", func(r chi.Router) {
+		r.Post("/", a.StartPodHandler)
+		r.Get("/", a.GetPodsHandler)
+		r.Delete("/{podID}", a.StopPodHandler)
+	})
+	a.Router.Route("/workflows", func(r chi.Router) {
+		r.Post("/", a.StartWorkflowHandler)
+		r.Get("/", a.GetWorkflowsHandler)
+		r.Get("/{workflowID}", a.GetWorkflowByIDHandler)
+	})
+	a.Router.Route("/crontasks", func(r chi.Router) {
+		r.Post("/", a.StartCronTaskHandler)
+		r.Get("/", a.GetCronTasksHandler)
+		r.Get("/{cronTaskID}", a.GetCronTaskByIDHandler)
+	})
+	a.Router.Route("/autoscalers", func(r chi.Router) {
+		r.Post("/", a.StartAutoscalerHandler)
+		r.Get("/", a.GetAutoscalersHandler)
+		r.Get("/{autoscalerID}", a.GetAutoscalerByIDHandler)
+		r.Delete("/{autoscalerID}", a.DeleteAutoscalerHandler)
+	})
+	a.Router.Route("/stats", func(r chi.Router) {
+		r.Get("/tasks", a.GetTaskUsageHandler)
+	})
+	a.Router.Get("/metrics", a.MetricsHandler)
+	a.Router.Get("/events", a.GetEventsHandler)
+	a.Router.Route("/schedule", func(r chi.Router) {
+		r.Post("/explain", a.ExplainScheduleHandler)
+	})
 	a.Router.Route("/nodes", func(r chi.Router) {
 		r.Get("/", a.GetNodesHandler)
+		r.Route("/{nodeName}", func(r chi.Router) {
+			r.Post("/cordon", a.CordonNodeHandler)
+			r.Post("/uncordon", a.UncordonNodeHandler)
+			r.Post("/drain", a.DrainNodeHandler)
+			r.Post("/taints", a.AddTaintHandler)
+			r.Delete("/taints/{key}", a.RemoveTaintHandler)
+		})
 	})
 }
 
 func (a *Api) Start() {
 	a.initRouter()
-	_ = http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	_ = http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), tracing.Handler(a.Router, "manager"))
 }
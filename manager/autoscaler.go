@@ -0,0 +1,232 @@
+package manager
+
+import (
+	"context"
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// 使用率与目标的比值在该范围内时不调整副本数
+const scaleTolerance = 0.1
+
+func (m *Manager) AddAutoscaler(a task.Autoscaler) (task.Autoscaler, error) {
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	a.Events = nil
+	a.Recommendations = nil
+
+	m.autoscalerMu.Lock()
+	defer m.autoscalerMu.Unlock()
+	if err := m.AutoscalerDb.Put(a.ID.String(), &a); err != nil {
+		return a, err
+	}
+	return a, nil
+}
+
+func (m *Manager) GetAutoscalers() []task.Autoscaler {
+	m.autoscalerMu.Lock()
+	defer m.autoscalerMu.Unlock()
+
+	result, err := m.AutoscalerDb.List()
+	if err != nil {
+		logger.Error("获取自动扩缩容列表失败", "error", err)
+		return nil
+	}
+	autoscalers := make([]task.Autoscaler, 0)
+	for _, a := range result.([]*task.Autoscaler) {
+		autoscalers = append(autoscalers, copyAutoscaler(a))
+	}
+	return autoscalers
+}
+
+func (m *Manager) GetAutoscaler(id uuid.UUID) (task.Autoscaler, error) {
+	m.autoscalerMu.Lock()
+	defer m.autoscalerMu.Unlock()
+
+	result, err := m.AutoscalerDb.Get(id.String())
+	if err != nil {
+		return task.Autoscaler{}, err
+	}
+	return copyAutoscaler(result.(*task.Autoscaler)), nil
+}
+
+// DeleteAutoscaler 删除自动扩缩容, 已创建的副本继续运行
+func (m *Manager) DeleteAutoscaler(id uuid.UUID) error {
+	m.autoscalerMu.Lock()
+	defer m.autoscalerMu.Unlock()
+
+	if _, err := m.AutoscalerDb.Get(id.String()); err != nil {
+		return err
+	}
+	return m.AutoscalerDb.Delete(id.String())
+}
+
+func copyAutoscaler(a *task.Autoscaler) task.Autoscaler {
+	c := *a
+	c.Events = append([]task.ScalingEvent(nil), a.Events...)
+	c.Recommendations = append([]task.Recommendation(nil), a.Recommendations...)
+	return c
+}
+
+func (m *Manager) processAutoscalers() {
+	m.autoscalerMu.Lock()
+	defer m.autoscalerMu.Unlock()
+
+	result, err := m.AutoscalerDb.List()
+	if err != nil {
+		logger.Error("获取自动扩缩容列表失败", "error", err)
+		return
+	}
+	for _, a := range result.([]*task.Autoscaler) {
+		m.autoscale(a)
+		_ = m.AutoscalerDb.Put(a.ID.String(), a)
+	}
+}
+
+// autoscale 根据副本的平均使用率计算建议副本数 ceil(当前副本数 * 当前使用率 / 目标使用率),
+// CPU 和内存取较大值, 经过稳定窗口后限制在最小和最大副本数之间
+func (m *Manager) autoscale(a *task.Autoscaler) {
+	replicas := m.serviceReplicas(a.Selector)
+	current := len(replicas)
+	usage := m.taskUsage()
+
+	var cpu, memory float64
+	var measured int
+	for _, t := range replicas {
+		u, ok := usage[t.ID.String()]
+		if !ok {
+			continue
+		}
+		measured++
+		cpu += u.Cpu
+		memory += float64(u.Memory)
+	}
+
+	recommended := current
+	var reasons []string
+	// 只计算设置了目标且模板请求了该资源的使用率, 避免除以 0 得到无法编码为 json 的 NaN 或者 Inf
+	a.CurrentCPUUtilization, a.CurrentMemoryUtilization = 0, 0
+	if measured > 0 {
+		recommended = 0
+		if a.TargetCPUUtilization > 0 && a.Template.Cpu > 0 {
+			a.CurrentCPUUtilization = 100 * cpu / (float64(measured) * a.Template.Cpu)
+			recommended = max(recommended, desiredReplicas(current, a.CurrentCPUUtilization, a.TargetCPUUtilization))
+			reasons = append(reasons, fmt.Sprintf("CPU 使用率 %.1f%%, 目标 %.1f%%", a.CurrentCPUUtilization, a.TargetCPUUtilization))
+		}
+		if a.TargetMemoryUtilization > 0 && a.Template.Memory > 0 {
+			a.CurrentMemoryUtilization = 100 * memory / (float64(measured) * float64(a.Template.Memory))
+			recommended = max(recommended, desiredReplicas(current, a.CurrentMemoryUtilization, a.TargetMemoryUtilization))
+			reasons = append(reasons, fmt.Sprintf("内存使用率 %.1f%%, 目标 %.1f%%", a.CurrentMemoryUtilization, a.TargetMemoryUtilization))
+		}
+	}
+
+	now := time.Now()
+	desired := a.Stabilize(now, current, recommended)
+	if desired < a.MinReplicas {
+		desired = a.MinReplicas
+		reasons = append(reasons, fmt.Sprintf("不少于最小副本数 %d", a.MinReplicas))
+	}
+	if desired > a.MaxReplicas {
+		desired = a.MaxReplicas
+		reasons = append(reasons, fmt.Sprintf("不超过最大副本数 %d", a.MaxReplicas))
+	}
+	a.CurrentReplicas = current
+	a.DesiredReplicas = desired
+	if desired == current {
+		return
+	}
+
+	e := task.ScalingEvent{Time: now, From: current, To: desired, Reason: strings.Join(reasons, "; ")}
+	logger.Info("自动扩缩容", "autoscaler_id", a.ID, "from", current, "to", desired, "reason", e.Reason)
+	if desired > current {
+		for i := current; i < desired; i++ {
+			m.addReplica(a)
+		}
+	} else {
+		m.removeReplicas(replicas, current-desired)
+	}
+	a.LastScaleTime = now
+	a.RecordEvent(e)
+}
+
+func desiredReplicas(current int, utilization float64, target float64) int {
+	ratio := utilization / target
+	if math.Abs(ratio-1) <= scaleTolerance {
+		return current
+	}
+	return int(math.Ceil(float64(current) * ratio))
+}
+
+// serviceReplicas 返回标签匹配 selector 且未结束的任务
+func (m *Manager) serviceReplicas(selector map[string]string) []*task.Task {
+	var replicas []*task.Task
+	for _, t := range m.GetTasks() {
+		if !task.MatchLabels(selector, t.Labels) {
+			continue
+		}
+		if t.State == task.Completed || t.State == task.Failed || t.State == task.Stopping {
+			continue
+		}
+		replicas = append(replicas, t)
+	}
+	return replicas
+}
+
+// taskUsage 汇总各节点最近一次上报的任务资源使用量
+func (m *Manager) taskUsage() map[string]task.Usage {
+	usage := make(map[string]task.Usage)
+	for _, n := range m.nodes() {
+		if n.Stale {
+			continue
+		}
+		for id, u := range n.Stats.TaskUsage {
+			usage[id] = u
+		}
+	}
+	return usage
+}
+
+// addReplica 以模板创建副本, 先以 Pending 状态写入任务存储, 使其在下发前也计入副本数
+func (m *Manager) addReplica(a *task.Autoscaler) {
+	t := a.Template
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s", a.Name, t.ID.String()[:8])
+	t.State = task.Pending
+	t.Transitions = nil
+	_ = m.TaskDb.Put(t.ID.String(), &t)
+
+	m.AddTask(task.Event{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	})
+}
+
+// removeReplicas 移除 n 个副本: 先取消尚未下发的副本, 再停止已下发的副本, 优先停止最晚启动的副本
+func (m *Manager) removeReplicas(replicas []*task.Task, n int) {
+	var dispatched []*task.Task
+	for _, t := range replicas {
+		if _, ok := m.taskWorker(t.ID); ok {
+			dispatched = append(dispatched, t)
+			continue
+		}
+		if n > 0 && m.cancelPending(*t, "ScaledDown") {
+			n--
+		}
+	}
+	sort.SliceStable(dispatched, func(i, j int) bool {
+		return dispatched[i].StartTime.After(dispatched[j].StartTime)
+	})
+	for i := 0; i < n && i < len(dispatched); i++ {
+		t := dispatched[i]
+		w, _ := m.taskWorker(t.ID)
+		_ = m.stopTask(context.Background(), w, t.ID.String())
+	}
+}
@@ -0,0 +1,64 @@
+package manager
+
+import (
+	"cube/task"
+	"github.com/google/uuid"
+)
+
+// addToBacklog 记录各节点未通过过滤的原因, 将无法调度的任务事件放入积压列表,
+// 等待集群容量变化后重试
+func (m *Manager) addToBacklog(te task.Event) {
+	te.Task.SchedulingErrors = m.scheduler.FilterReasons(te.Task, m.nodes())
+
+	_ = m.transition(&te.Task, task.Unschedulable, "NoNodesAvailable")
+	t := te.Task
+	_ = m.TaskDb.Put(t.ID.String(), &t)
+
+	m.backlogMu.Lock()
+	defer m.backlogMu.Unlock()
+	m.backlog = append(m.backlog, te)
+	logger.Warn("任务无法调度, 放入积压列表", "task_id", t.ID, "event_id", te.ID, "reasons", t.SchedulingErrors)
+}
+
+func (m *Manager) removeFromBacklog(id uuid.UUID) bool {
+	m.backlogMu.Lock()
+	defer m.backlogMu.Unlock()
+
+	for i, te := range m.backlog {
+		if te.Task.ID == id {
+			m.backlog = append(m.backlog[:i], m.backlog[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// cancelPending 从 Pending 队列或者积压列表中移除尚未下发的任务, 任务记录标记为 Completed
+func (m *Manager) cancelPending(t task.Task, reason string) bool {
+	if !m.Pending.Remove(t.ID) && !m.removeFromBacklog(t.ID) {
+		return false
+	}
+	if result, err := m.TaskDb.Get(t.ID.String()); err == nil {
+		t = *result.(*task.Task)
+	}
+	_ = m.transition(&t, task.Completed, reason)
+	_ = m.TaskDb.Put(t.ID.String(), &t)
+	logger.Info("取消尚未下发的任务", "task_id", t.ID, "reason", reason)
+	return true
+}
+
+// retryBacklog 在集群容量变化 (节点就绪, 恢复调度, 任务结束) 时将积压任务重新加入 Pending 队列
+func (m *Manager) retryBacklog(reason string) {
+	m.backlogMu.Lock()
+	events := m.backlog
+	m.backlog = nil
+	m.backlogMu.Unlock()
+
+	if len(events) == 0 {
+		return
+	}
+	logger.Info("重试积压任务", "reason", reason, "count", len(events))
+	for _, te := range events {
+		m.Pending.Enqueue(te)
+	}
+}
@@ -0,0 +1,184 @@
+package manager
+
+import (
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (m *Manager) AddCronTask(c task.CronTask) (task.CronTask, error) {
+	schedule, err := c.Validate()
+	if err != nil {
+		return c, err
+	}
+	loc, _ := c.Location()
+	if c.ID == uuid.Nil {
+		c.ID = uuid.New()
+	}
+	// 从创建时间开始计算运行时间, 不补运行创建之前的时间
+	c.LastScheduleTime = time.Now().In(loc)
+	c.NextScheduleTime = schedule.Next(c.LastScheduleTime)
+	c.Active = nil
+	c.History = nil
+	c.MissedRuns = nil
+	c.MissedRunCount = 0
+
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+	if err := m.CronDb.Put(c.ID.String(), &c); err != nil {
+		return c, err
+	}
+	return c, nil
+}
+
+func (m *Manager) GetCronTasks() []*task.CronTask {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	result, err := m.CronDb.List()
+	if err != nil {
+		logger.Error("获取定时任务列表失败", "error", err)
+		return nil
+	}
+	return result.([]*task.CronTask)
+}
+
+func (m *Manager) GetCronTask(id uuid.UUID) (*task.CronTask, error) {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	result, err := m.CronDb.Get(id.String())
+	if err != nil {
+		return nil, err
+	}
+	return result.(*task.CronTask), nil
+}
+
+func (m *Manager) processCronTasks() {
+	m.cronMu.Lock()
+	defer m.cronMu.Unlock()
+
+	result, err := m.CronDb.List()
+	if err != nil {
+		logger.Error("获取定时任务列表失败", "error", err)
+		return
+	}
+	for _, c := range result.([]*task.CronTask) {
+		m.syncCronRuns(c)
+		m.scheduleCronTask(c)
+		_ = m.CronDb.Put(c.ID.String(), c)
+	}
+}
+
+// syncCronRuns 将已结束的运行从 Active 移到 History, 并按历史记录数限制清理
+func (m *Manager) syncCronRuns(c *task.CronTask) {
+	var active []task.CronRun
+	for _, r := range c.Active {
+		result, err := m.TaskDb.Get(r.TaskID.String())
+		if err != nil {
+			// 任务尚未下发
+			active = append(active, r)
+			continue
+		}
+		t := result.(*task.Task)
+		r.State = t.State
+		if t.State != task.Completed && t.State != task.Failed {
+			active = append(active, r)
+			continue
+		}
+		r.FinishTime = t.FinishTime
+		c.History = append(c.History, r)
+	}
+	c.Active = active
+	c.TrimHistory()
+}
+
+// scheduleCronTask 计算上次运行之后到现在应当运行的时间, 只运行最近的一次,
+// 更早的时间 (例如 manager 停止期间) 以及超过补运行期限的时间记录为错过的运行
+func (m *Manager) scheduleCronTask(c *task.CronTask) {
+	schedule, err := task.ParseCron(c.Schedule)
+	if err != nil {
+		logger.Error("定时任务表达式无效", "cron_task_id", c.ID, "error", err)
+		return
+	}
+	loc, err := c.Location()
+	if err != nil {
+		logger.Error("定时任务时区无效", "cron_task_id", c.ID, "error", err)
+		return
+	}
+
+	now := time.Now().In(loc)
+	var due []time.Time
+	for t := schedule.Next(c.LastScheduleTime.In(loc)); !t.IsZero() && !t.After(now); t = schedule.Next(t) {
+		due = append(due, t)
+	}
+	c.NextScheduleTime = schedule.Next(now)
+	if len(due) == 0 {
+		return
+	}
+
+	latest := due[len(due)-1]
+	missed := due[:len(due)-1]
+	c.LastScheduleTime = latest
+	if c.StartingDeadlineSeconds != nil && now.Sub(latest) > time.Duration(*c.StartingDeadlineSeconds)*time.Second {
+		missed = due
+	}
+	if len(missed) > 0 {
+		logger.Warn("定时任务错过运行", "cron_task_id", c.ID, "missed", len(missed), "last_missed", missed[len(missed)-1])
+		c.RecordMissed(missed...)
+	}
+	if len(missed) < len(due) {
+		m.runCronTask(c, latest)
+	}
+}
+
+func (m *Manager) runCronTask(c *task.CronTask, at time.Time) {
+	if len(c.Active) > 0 {
+		switch c.ConcurrencyPolicy {
+		case task.ConcurrencyForbid:
+			logger.Info("定时任务上次运行尚未结束, 跳过本次运行", "cron_task_id", c.ID, "scheduled_time", at)
+			return
+		case task.ConcurrencyReplace:
+			for _, r := range c.Active {
+				m.stopCronRun(c, r)
+			}
+		}
+	}
+
+	t := cronRunTask(c, uuid.New(), at)
+	m.AddTask(task.Event{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	})
+	c.Active = append(c.Active, task.CronRun{TaskID: t.ID, ScheduledTime: at, State: task.Pending})
+	logger.Info("定时任务创建任务", "cron_task_id", c.ID, "task_id", t.ID, "scheduled_time", at)
+}
+
+func cronRunTask(c *task.CronTask, id uuid.UUID, at time.Time) task.Task {
+	t := c.Task
+	t.ID = id
+	t.Name = fmt.Sprintf("%s-%d", c.Name, at.Unix())
+	t.CronTaskID = c.ID
+	t.State = task.Pending
+	t.Transitions = nil
+	return t
+}
+
+// stopCronRun 停止上次运行: 已下发的任务请求 worker 停止, 尚未下发的任务从 Pending 队列或者积压列表中移除
+func (m *Manager) stopCronRun(c *task.CronTask, r task.CronRun) {
+	if _, ok := m.taskWorker(r.TaskID); ok {
+		if result, err := m.TaskDb.Get(r.TaskID.String()); err == nil {
+			logger.Info("定时任务停止上次运行的任务", "cron_task_id", c.ID, "task_id", r.TaskID)
+			m.enqueueStop(*result.(*task.Task))
+		}
+		return
+	}
+	if m.cancelPending(cronRunTask(c, r.TaskID, r.ScheduledTime), "Replaced") {
+		logger.Info("定时任务取消上次尚未下发的运行", "cron_task_id", c.ID, "task_id", r.TaskID)
+		return
+	}
+	logger.Warn("定时任务上次运行既未下发也不在队列中, 无法停止", "cron_task_id", c.ID, "task_id", r.TaskID)
+}
@@ -0,0 +1,267 @@
+package manager
+
+import (
+	"cube/store"
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// 保留的集群事件数
+	maxClusterEvents = 10000
+	// 每个 watch 连接缓冲的事件数, 缓冲满时断开连接, 由客户端带上最后收到的序号重新连接
+	watchBufferSize = 256
+)
+
+// 集群事件类型
+const (
+	EventTaskSubmitted     = "TaskSubmitted"
+	EventTaskStopRequested = "TaskStopRequested"
+	EventTaskPending       = "TaskPending"
+	EventTaskScheduled     = "TaskScheduled"
+	EventTaskPulling       = "TaskPulling"
+	EventTaskStarting      = "TaskStarting"
+	EventTaskStarted       = "TaskStarted"
+	EventTaskStopping      = "TaskStopping"
+	EventTaskCompleted     = "TaskCompleted"
+	EventTaskFailed        = "TaskFailed"
+	EventTaskRestarted     = "TaskRestarted"
+	EventTaskLost          = "TaskLost"
+	EventTaskUnschedulable = "TaskUnschedulable"
+	EventNodeReady         = "NodeReady"
+	EventNodeNotReady      = "NodeNotReady"
+	EventNodeCordoned      = "NodeCordoned"
+	EventNodeUncordoned    = "NodeUncordoned"
+	EventNodeDrained       = "NodeDrained"
+)
+
+// 任务转换到各状态时记录的事件类型
+var transitionEvents = map[task.State]string{
+	task.Pending:       EventTaskPending,
+	task.Scheduled:     EventTaskScheduled,
+	task.Pulling:       EventTaskPulling,
+	task.Starting:      EventTaskStarting,
+	task.Running:       EventTaskStarted,
+	task.Stopping:      EventTaskStopping,
+	task.Completed:     EventTaskCompleted,
+	task.Failed:        EventTaskFailed,
+	task.Restarting:    EventTaskRestarted,
+	task.Lost:          EventTaskLost,
+	task.Unschedulable: EventTaskUnschedulable,
+}
+
+// EventFilter 为空的字段不参与过滤
+type EventFilter struct {
+	TaskID uuid.UUID
+	Node   string
+	Types  []string
+	Since  time.Time
+	Until  time.Time
+	// 只返回序号大于 After 的事件
+	After uint64
+}
+
+func (f EventFilter) Match(e task.ClusterEvent) bool {
+	if f.TaskID != uuid.Nil && e.TaskID != f.TaskID {
+		return false
+	}
+	if f.Node != "" && e.Node != f.Node {
+		return false
+	}
+	if len(f.Types) > 0 {
+		matched := false
+		for _, t := range f.Types {
+			if t == e.Type {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && e.Time.After(f.Until) {
+		return false
+	}
+	return e.Seq > f.After
+}
+
+// eventLog 保留最近 maxClusterEvents 条集群事件并写入集群事件存储, manager 重启后从存储中恢复, 序号继续递增。
+// 新事件同时发送给 watch 连接
+type eventLog struct {
+	mu       sync.Mutex
+	db       store.Store
+	seq      uint64
+	events   []task.ClusterEvent
+	watchers map[chan task.ClusterEvent]EventFilter
+}
+
+func newEventLog(db store.Store) *eventLog {
+	l := &eventLog{db: db, watchers: make(map[chan task.ClusterEvent]EventFilter)}
+	result, err := db.List()
+	if err != nil {
+		logger.Error("读取集群事件失败", "error", err)
+		return l
+	}
+	events := result.([]*task.ClusterEvent)
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Seq < events[j].Seq
+	})
+	for _, e := range events {
+		l.events = append(l.events, *e)
+	}
+	if n := len(l.events); n > 0 {
+		l.seq = l.events[n-1].Seq
+	}
+	l.trim()
+	return l
+}
+
+// eventKey 使用定长的序号作为存储的 key, 按 key 排序即按序号排序
+func eventKey(seq uint64) string {
+	return fmt.Sprintf("%020d", seq)
+}
+
+// trim 删除超出保留数量的最早事件
+func (l *eventLog) trim() {
+	n := len(l.events) - maxClusterEvents
+	if n <= 0 {
+		return
+	}
+	for _, e := range l.events[:n] {
+		if err := l.db.Delete(eventKey(e.Seq)); err != nil {
+			logger.Error("删除集群事件失败", "seq", e.Seq, "error", err)
+		}
+	}
+	l.events = l.events[n:]
+}
+
+func (l *eventLog) append(e task.ClusterEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	e.Seq = l.seq
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	if err := l.db.Put(eventKey(e.Seq), &e); err != nil {
+		logger.Error("保存集群事件失败", "seq", e.Seq, "error", err)
+	}
+	l.events = append(l.events, e)
+	l.trim()
+
+	for ch, f := range l.watchers {
+		if !f.Match(e) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			delete(l.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+// checkAfter 检查继续读取的起点是否仍在保留的事件范围内, 不在范围内时客户端需要去掉序号重新读取
+func (l *eventLog) checkAfter(after uint64) error {
+	if after == 0 {
+		return nil
+	}
+	if after > l.seq {
+		return fmt.Errorf("事件序号 %d 大于当前序号 %d", after, l.seq)
+	}
+	if len(l.events) > 0 && after < l.events[0].Seq-1 {
+		return fmt.Errorf("事件序号 %d 已过期, 最早保留的事件序号为 %d", after, l.events[0].Seq)
+	}
+	return nil
+}
+
+func (l *eventLog) list(f EventFilter) ([]task.ClusterEvent, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.checkAfter(f.After); err != nil {
+		return nil, err
+	}
+	return l.match(f), nil
+}
+
+func (l *eventLog) match(f EventFilter) []task.ClusterEvent {
+	result := []task.ClusterEvent{}
+	for _, e := range l.events {
+		if f.Match(e) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+// watch 返回已有的匹配事件, 以及之后新事件的 channel, 两者之间不会遗漏或者重复事件。
+// 连接结束时调用返回的函数取消 watch
+func (l *eventLog) watch(f EventFilter) ([]task.ClusterEvent, <-chan task.ClusterEvent, func(), error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.checkAfter(f.After); err != nil {
+		return nil, nil, nil, err
+	}
+
+	ch := make(chan task.ClusterEvent, watchBufferSize)
+	l.watchers[ch] = f
+	cancel := func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		if _, ok := l.watchers[ch]; ok {
+			delete(l.watchers, ch)
+			close(ch)
+		}
+	}
+	return l.match(f), ch, cancel, nil
+}
+
+func (m *Manager) GetEvents(f EventFilter) ([]task.ClusterEvent, error) {
+	return m.events.list(f)
+}
+
+func (m *Manager) WatchEvents(f EventFilter) ([]task.ClusterEvent, <-chan task.ClusterEvent, func(), error) {
+	return m.events.watch(f)
+}
+
+func (m *Manager) recordEvent(typ string, reason string, message string, taskID uuid.UUID, node string) {
+	m.events.append(task.ClusterEvent{Type: typ, Reason: reason, Message: message, TaskID: taskID, Node: node})
+}
+
+func (m *Manager) recordNodeEvent(typ string, node string, message string) {
+	m.recordEvent(typ, "", message, uuid.Nil, node)
+}
+
+// transition 转换任务状态并记录集群事件
+func (m *Manager) transition(t *task.Task, dst task.State, reason string) error {
+	n := len(t.Transitions)
+	if err := t.TransitionTo(dst, reason); err != nil {
+		return err
+	}
+	m.recordTransitions(t, n)
+	return nil
+}
+
+// recordTransitions 为任务从第 n 条开始的状态转换记录集群事件, 事件时间为转换发生的时间
+func (m *Manager) recordTransitions(t *task.Task, n int) {
+	for _, tr := range t.Transitions[n:] {
+		m.events.append(task.ClusterEvent{
+			Time:    tr.Time,
+			Type:    transitionEvents[tr.To],
+			Reason:  tr.Reason,
+			Message: fmt.Sprintf("任务 %s 状态 %v -> %v", t.Name, tr.From, tr.To),
+			TaskID:  t.ID,
+			Node:    t.Node,
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package manager
+
+import (
+	"context"
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (m *Manager) AddGang(g task.Gang) task.Gang {
+	if g.ID == uuid.Nil {
+		g.ID = uuid.New()
+	}
+	g.State = task.Pending
+	for i := range g.Tasks {
+		if g.Tasks[i].ID == uuid.Nil {
+			g.Tasks[i].ID = uuid.New()
+		}
+		g.Tasks[i].State = task.Pending
+		g.Tasks[i].Transitions = nil
+		t := g.Tasks[i]
+		_ = m.TaskDb.Put(t.ID.String(), &t)
+	}
+
+	m.gangMu.Lock()
+	defer m.gangMu.Unlock()
+	m.gangs = append(m.gangs, &g)
+	return g
+}
+
+// GetGangs 返回所有任务组, 任务组状态由成员任务状态汇总得到
+func (m *Manager) GetGangs() []task.Gang {
+	m.gangMu.Lock()
+	defer m.gangMu.Unlock()
+
+	gangs := make([]task.Gang, 0, len(m.gangs))
+	for _, g := range m.gangs {
+		gang := *g
+		gang.Tasks = make([]task.Task, len(g.Tasks))
+		for i, member := range g.Tasks {
+			gang.Tasks[i] = member
+			if result, err := m.TaskDb.Get(member.ID.String()); err == nil {
+				gang.Tasks[i] = *result.(*task.Task)
+			}
+		}
+		if gang.State == task.Scheduled {
+			gang.State = aggregateState(gang.Tasks)
+		}
+		gangs = append(gangs, gang)
+	}
+	return gangs
+}
+
+func aggregateState(tasks []task.Task) task.State {
+	running, completed := 0, 0
+	for _, t := range tasks {
+		switch t.State {
+		case task.Failed:
+			return task.Failed
+		case task.Running:
+			running++
+		case task.Completed:
+			completed++
+		}
+	}
+	switch {
+	case completed == len(tasks):
+		return task.Completed
+	case running+completed == len(tasks):
+		return task.Running
+	}
+	return task.Scheduled
+}
+
+// 任务组下发失败后重试的间隔, 每次失败加倍, 不超过 gangMaxBackoff
+const (
+	gangBackoff    = 10 * time.Second
+	gangMaxBackoff = 5 * time.Minute
+)
+
+func (m *Manager) processGangs() {
+	m.gangMu.Lock()
+	var pending []*task.Gang
+	for _, g := range m.gangs {
+		if g.State == task.Pending && !time.Now().Before(g.RetryAfter) {
+			pending = append(pending, g)
+		}
+	}
+	m.gangMu.Unlock()
+
+	for _, g := range pending {
+		m.scheduleGang(g)
+	}
+}
+
+// scheduleGang 为所有成员预留资源后一起下发, 任一成员无法调度时回滚预留, 任务组留待下次重试
+func (m *Manager) scheduleGang(g *task.Gang) {
+	placements, err := m.reserveGang(g)
+	if err != nil {
+		logger.Warn("任务组无法调度", "gang_id", g.ID, "error", err)
+		return
+	}
+
+	var dispatched []task.Task
+	for i, t := range g.Tasks {
+		te := task.Event{
+			ID:        uuid.New(),
+			State:     task.Running,
+			Timestamp: time.Now(),
+			Task:      t,
+		}
+		if err := m.dispatch(te, placements[i]); err != nil {
+			m.rollbackGang(g, dispatched, err)
+			return
+		}
+		dispatched = append(dispatched, t)
+	}
+
+	m.gangMu.Lock()
+	g.State = task.Scheduled
+	m.gangMu.Unlock()
+	logger.Info("任务组成员已全部下发", "gang_id", g.ID, "members", len(g.Tasks))
+}
+
+// rollbackGang 成员下发失败时停止已下发的成员, 将所有成员恢复为 Pending 并释放预留的资源,
+// 任务组留在队列中按退避时间重试。已下发的成员以新 ID 重新创建, 停止的任务保留原记录
+func (m *Manager) rollbackGang(g *task.Gang, dispatched []task.Task, err error) {
+	m.gangMu.Lock()
+	g.Attempts++
+	backoff := gangBackoff << (g.Attempts - 1)
+	if backoff > gangMaxBackoff || backoff <= 0 {
+		backoff = gangMaxBackoff
+	}
+	g.RetryAfter = time.Now().Add(backoff)
+	m.gangMu.Unlock()
+	logger.Warn("任务组成员下发失败, 停止已下发的成员, 稍后重试", "gang_id", g.ID, "attempts", g.Attempts, "retry_after", backoff, "error", err)
+
+	stopped := make(map[uuid.UUID]bool)
+	for _, d := range dispatched {
+		if w, ok := m.taskWorker(d.ID); ok {
+			_ = m.stopTask(context.Background(), w, d.ID.String())
+		}
+		stopped[d.ID] = true
+	}
+	for i := range g.Tasks {
+		if stopped[g.Tasks[i].ID] {
+			g.Tasks[i].ID = uuid.New()
+		}
+		g.Tasks[i].Reason = fmt.Sprintf("DispatchFailed: %v", err)
+		t := g.Tasks[i]
+		_ = m.TaskDb.Put(t.ID.String(), &t)
+	}
+	m.syncNodeTasks()
+}
+
+// reserveGang 依次为每个成员选择节点, 并将成员计入所选节点以预留资源,
+// 后续成员的调度会考虑已预留的资源和标签。预留记录在节点快照上, 任一成员无法调度时丢弃快照即撤销全部预留
+func (m *Manager) reserveGang(g *task.Gang) ([]*node.Node, error) {
+	m.syncNodeTasks()
+	nodes := m.nodes()
+
+	placements := make([]*node.Node, 0, len(g.Tasks))
+	for i := range g.Tasks {
+		t := g.Tasks[i]
+		candidates := m.scheduler.SelectCandidateNodes(t, nodes)
+		if len(candidates) == 0 {
+			_ = m.transition(&t, task.Unschedulable, "NoNodesAvailable")
+			t.SchedulingErrors = m.scheduler.FilterReasons(t, nodes)
+			_ = m.TaskDb.Put(t.ID.String(), &t)
+			return nil, fmt.Errorf("成员 %s 没有可用的候选节点", t.ID)
+		}
+		scores := m.scheduler.Score(t, candidates)
+		n := m.scheduler.Pick(scores, candidates)
+
+		n.Tasks = append(n.Tasks, &g.Tasks[i])
+		n.UpdateAllocated()
+		placements = append(placements, n)
+	}
+
+	return placements, nil
+}
@@ -0,0 +1,117 @@
+package manager
+
+import (
+	"context"
+	"cube/task"
+	"cube/tracing"
+	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+)
+
+// collectGarbage 删除超过 TTLSecondsAfterFinished 的已结束任务: 先让 worker 移除保留的容器和任务记录,
+// 成功后再删除 manager 上的任务记录, 最后一次遍历删除这些任务的事件, worker 不可达时下次重试。
+// 属于定时任务或者工作流的任务等到它们记录了任务的结果之后再删除
+func (m *Manager) collectGarbage() {
+	deleted := make(map[uuid.UUID]bool)
+	for _, t := range m.GetTasks() {
+		if !t.Expired() {
+			continue
+		}
+		if !m.ownerRecorded(t) {
+			logger.Debug("任务的结果尚未被定时任务或者工作流记录, 暂不删除", "task_id", t.ID)
+			continue
+		}
+		if w, ok := m.taskWorker(t.ID); ok {
+			if err := m.purgeTask(w, t.ID.String()); err != nil {
+				logger.Warn("删除 worker 上的任务失败", "task_id", t.ID, "node", w, "error", err)
+				continue
+			}
+			m.unassign(t.ID, w)
+		}
+
+		_ = m.TaskDb.Delete(t.ID.String())
+		deleted[t.ID] = true
+		logger.Info("任务结束超过保留时间, 已删除", "task_id", t.ID, "ttl_seconds", *t.TTLSecondsAfterFinished)
+	}
+	if len(deleted) > 0 {
+		m.deleteTaskEvents(deleted)
+	}
+}
+
+// ownerRecorded 任务所属的定时任务已将它移到运行历史, 或者所属工作流的步骤已同步了它的结束状态。
+// 定时任务或者工作流已被删除时返回 true
+func (m *Manager) ownerRecorded(t *task.Task) bool {
+	if t.CronTaskID != uuid.Nil {
+		m.cronMu.Lock()
+		result, err := m.CronDb.Get(t.CronTaskID.String())
+		m.cronMu.Unlock()
+		if err != nil {
+			return true
+		}
+		for _, r := range result.(*task.CronTask).Active {
+			if r.TaskID == t.ID {
+				return false
+			}
+		}
+	}
+	if t.WorkflowID != uuid.Nil {
+		m.workflowMu.Lock()
+		result, err := m.WorkflowDb.Get(t.WorkflowID.String())
+		m.workflowMu.Unlock()
+		if err != nil {
+			return true
+		}
+		for _, s := range result.(*task.Workflow).Steps {
+			// 只有步骤的当前运行需要同步状态, 之前的运行已被重试取代
+			if n := len(s.TaskIDs); n > 0 && s.TaskIDs[n-1] == t.ID && s.State != t.State {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m *Manager) purgeTask(worker string, taskID string) (err error) {
+	ctx, span := tracer.Start(context.Background(), "manager.purge_task", trace.WithAttributes(
+		attribute.String("task.id", taskID),
+		attribute.String("node", worker),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	url := fmt.Sprintf("http://%s/tasks/%s/purge", worker, taskID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tracing.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// worker 上已经没有该任务
+	if resp.StatusCode == http.StatusNoContent || resp.StatusCode == http.StatusNotFound {
+		return nil
+	}
+	return fmt.Errorf("响应状态码 %d", resp.StatusCode)
+}
+
+// deleteTaskEvents 遍历一次任务事件, 删除属于 ids 中任务的事件
+func (m *Manager) deleteTaskEvents(ids map[uuid.UUID]bool) {
+	result, err := m.EventDb.List()
+	if err != nil {
+		logger.Error("获取任务事件列表失败", "error", err)
+		return
+	}
+	for _, te := range result.([]*task.Event) {
+		if ids[te.Task.ID] {
+			_ = m.EventDb.Delete(te.ID.String())
+		}
+	}
+}
@@ -1,13 +1,17 @@
 package manager
 
 import (
+	"cube/node"
+	"cube/store"
 	"cube/task"
+	"cube/tracing"
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"log"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,7 +23,7 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	err := d.Decode(&te)
 	if err != nil {
 		msg := fmt.Sprintf("json 解码失败: %v\n", err)
-		log.Println(msg)
+		logger.Warn("json 解码失败", "error", err)
 		w.WriteHeader(400)
 		e := ErrResponse{
 			HTTPStatusCode: 400,
@@ -29,47 +33,669 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// 新提交的任务从 Pending 状态开始记录状态转换历史
+	if te.State == task.Running {
+		te.Task.State = task.Pending
+		te.Task.Transitions = nil
+	}
+	te.TraceContext = tracing.Inject(r.Context())
 	a.Manager.AddTask(te)
-	log.Printf("添加任务: %v\n", te.Task.ID)
+	if te.State == task.Running {
+		a.Manager.recordEvent(EventTaskSubmitted, "", fmt.Sprintf("提交任务 %s, 镜像 %s", te.Task.Name, te.Task.Image), te.Task.ID, "")
+	}
+	logger.Info("添加任务", "task_id", te.Task.ID, "event_id", te.ID)
 	w.WriteHeader(201)
 	_ = json.NewEncoder(w).Encode(te.Task)
 }
 
 func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("watch") == "true" {
+		serveWatch(w, r, a.Manager.WatchTasks)
+		return
+	}
+
+	q, err := parseTaskQuery(r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	version := a.Manager.taskWatch.resourceVersion()
+	page, err := a.Manager.QueryTasks(q)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Resource-Version", strconv.FormatUint(version, 10))
+	if page.NextCursor != "" {
+		w.Header().Set("X-Next-Cursor", page.NextCursor)
+	}
 	w.WriteHeader(200)
-	_ = json.NewEncoder(w).Encode(a.Manager.GetTasks())
+	_ = json.NewEncoder(w).Encode(page.Tasks)
+}
+
+func (a *Api) GetTaskByIDHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的任务 id: %v", taskID))
+		return
+	}
+	t, err := a.Manager.TaskDb.Get(tID.String())
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(t)
 }
 
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskID := chi.URLParam(r, "taskID")
 	if taskID == "" {
-		log.Printf("未传递 id 参数\n")
+		logger.Warn("未传递 id 参数")
 		w.WriteHeader(400)
+		return
 	}
 	tID, _ := uuid.Parse(taskID)
 	taskToStop, err := a.Manager.TaskDb.Get(tID.String())
 	if err != nil {
-		log.Printf("任务 id: %v\n 未找到", tID)
+		logger.Warn("任务未找到", "task_id", tID)
 		w.WriteHeader(404)
+		return
 	}
 
-	te := task.Event{
-		ID:        uuid.New(),
-		State:     task.Completed,
-		Timestamp: time.Now(),
+	a.Manager.enqueueStop(*taskToStop.(*task.Task))
+	w.WriteHeader(204)
+}
+
+// StopTasksHandler 停止标签匹配查询参数 labels 的所有任务
+func (a *Api) StopTasksHandler(w http.ResponseWriter, r *http.Request) {
+	selector, err := task.ParseSelector(r.URL.Query().Get("labels"))
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	stopped, err := a.Manager.StopTasks(selector)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
 	}
 
-	taskCopy := taskToStop.(*task.Task)
-	te.Task = *taskCopy
-	a.Manager.AddTask(te)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(stopped)
+}
 
-	log.Printf("添加任务事件: %v，停止任务: %v\n", te.ID, taskCopy.ID)
-	w.WriteHeader(204)
+func (a *Api) GetTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的任务 id: %v", taskID))
+		return
+	}
+	if _, err := a.Manager.TaskDb.Get(tID.String()); err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	history, err := a.Manager.GetTaskUsageHistory(tID)
+	if err != nil {
+		writeError(w, 502, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(history)
+}
+
+func (a *Api) GetTaskUsageHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetTaskUsage())
+}
+
+func (a *Api) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.Manager.collectMetrics()
+	metricsHandler.ServeHTTP(w, r)
 }
 
 func (a *Api) GetNodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("watch") == "true" {
+		serveWatch(w, r, a.Manager.WatchNodes)
+		return
+	}
+
 	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Resource-Version", strconv.FormatUint(a.Manager.nodeWatch.resourceVersion(), 10))
 	w.WriteHeader(200)
 	_ = json.NewEncoder(w).Encode(a.Manager.WorkerNodes())
 }
+
+func (a *Api) StartGangHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	g := task.Gang{}
+	err := d.Decode(&g)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+	if len(g.Tasks) == 0 {
+		writeError(w, 400, "任务组没有成员任务")
+		return
+	}
+
+	g = a.Manager.AddGang(g)
+	logger.Info("添加任务组", "gang_id", g.ID, "members", len(g.Tasks))
+	w.WriteHeader(201)
+	_ = json.NewEncoder(w).Encode(g)
+}
+
+func (a *Api) GetGangsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetGangs())
+}
+
+func (a *Api) StartPodHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	p := task.Pod{}
+	err := d.Decode(&p)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+	if len(p.Tasks) == 0 {
+		writeError(w, 400, "Pod 没有成员任务")
+		return
+	}
+	if err := p.Validate(); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	p = a.Manager.AddPod(p)
+	logger.Info("添加 Pod", "pod_id", p.ID, "members", len(p.Tasks))
+	w.WriteHeader(201)
+	_ = json.NewEncoder(w).Encode(p)
+}
+
+func (a *Api) GetPodsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetPods())
+}
+
+func (a *Api) StopPodHandler(w http.ResponseWriter, r *http.Request) {
+	podID, err := uuid.Parse(chi.URLParam(r, "podID"))
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的 Pod id: %v", chi.URLParam(r, "podID")))
+		return
+	}
+	if err := a.Manager.StopPod(podID); err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	w.WriteHeader(204)
+}
+
+func (a *Api) StartWorkflowHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	wf := task.Workflow{}
+	err := d.Decode(&wf)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+	if err := wf.Validate(); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	wf, err = a.Manager.AddWorkflow(wf)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	logger.Info("添加工作流", "workflow_id", wf.ID, "steps", len(wf.Steps))
+	w.WriteHeader(201)
+	_ = json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) GetWorkflowsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetWorkflows())
+}
+
+func (a *Api) GetWorkflowByIDHandler(w http.ResponseWriter, r *http.Request) {
+	workflowID, err := uuid.Parse(chi.URLParam(r, "workflowID"))
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的工作流 id: %v", chi.URLParam(r, "workflowID")))
+		return
+	}
+	wf, err := a.Manager.GetWorkflow(workflowID)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(wf)
+}
+
+func (a *Api) StartCronTaskHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	c := task.CronTask{}
+	err := d.Decode(&c)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+
+	c, err = a.Manager.AddCronTask(c)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	logger.Info("添加定时任务", "cron_task_id", c.ID, "schedule", c.Schedule, "next", c.NextScheduleTime)
+	w.WriteHeader(201)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+func (a *Api) GetCronTasksHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetCronTasks())
+}
+
+func (a *Api) GetCronTaskByIDHandler(w http.ResponseWriter, r *http.Request) {
+	cronTaskID, err := uuid.Parse(chi.URLParam(r, "cronTaskID"))
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的定时任务 id: %v", chi.URLParam(r, "cronTaskID")))
+		return
+	}
+	c, err := a.Manager.GetCronTask(cronTaskID)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(c)
+}
+
+func (a *Api) StartAutoscalerHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	as := task.Autoscaler{}
+	err := d.Decode(&as)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+	if err := as.Validate(); err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	as, err = a.Manager.AddAutoscaler(as)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	logger.Info("添加自动扩缩容", "autoscaler_id", as.ID, "min_replicas", as.MinReplicas, "max_replicas", as.MaxReplicas)
+	w.WriteHeader(201)
+	_ = json.NewEncoder(w).Encode(as)
+}
+
+func (a *Api) GetAutoscalersHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.GetAutoscalers())
+}
+
+func (a *Api) GetAutoscalerByIDHandler(w http.ResponseWriter, r *http.Request) {
+	autoscalerID, err := uuid.Parse(chi.URLParam(r, "autoscalerID"))
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的自动扩缩容 id: %v", chi.URLParam(r, "autoscalerID")))
+		return
+	}
+	as, err := a.Manager.GetAutoscaler(autoscalerID)
+	if err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(as)
+}
+
+func (a *Api) DeleteAutoscalerHandler(w http.ResponseWriter, r *http.Request) {
+	autoscalerID, err := uuid.Parse(chi.URLParam(r, "autoscalerID"))
+	if err != nil {
+		writeError(w, 400, fmt.Sprintf("无效的自动扩缩容 id: %v", chi.URLParam(r, "autoscalerID")))
+		return
+	}
+	if err := a.Manager.DeleteAutoscaler(autoscalerID); err != nil {
+		writeError(w, 404, err.Error())
+		return
+	}
+	logger.Info("删除自动扩缩容", "autoscaler_id", autoscalerID)
+	w.WriteHeader(204)
+}
+
+func (a *Api) ExplainScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	te := task.Event{}
+	err := d.Decode(&te)
+	if err != nil {
+		msg := fmt.Sprintf("json 解码失败: %v\n", err)
+		logger.Warn("json 解码失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Manager.ExplainSchedule(te.Task))
+}
+
+func (a *Api) CordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	a.nodeAction(w, r, a.Manager.CordonNode)
+}
+
+func (a *Api) UncordonNodeHandler(w http.ResponseWriter, r *http.Request) {
+	a.nodeAction(w, r, a.Manager.UncordonNode)
+}
+
+func (a *Api) DrainNodeHandler(w http.ResponseWriter, r *http.Request) {
+	a.nodeAction(w, r, a.Manager.DrainNode)
+}
+
+func (a *Api) AddTaintHandler(w http.ResponseWriter, r *http.Request) {
+	d := json.NewDecoder(r.Body)
+	d.DisallowUnknownFields()
+
+	taint := node.Taint{}
+	err := d.Decode(&taint)
+	if err == nil {
+		_, err = node.ParseTaint(taint.String())
+	}
+	if err != nil {
+		msg := fmt.Sprintf("污点解析失败: %v\n", err)
+		logger.Warn("污点解析失败", "error", err)
+		writeError(w, 400, msg)
+		return
+	}
+
+	a.nodeAction(w, r, func(name string) error {
+		return a.Manager.AddTaint(name, taint)
+	})
+}
+
+func (a *Api) RemoveTaintHandler(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	a.nodeAction(w, r, func(name string) error {
+		return a.Manager.RemoveTaint(name, key)
+	})
+}
+
+func (a *Api) nodeAction(w http.ResponseWriter, r *http.Request, action func(name string) error) {
+	name := chi.URLParam(r, "nodeName")
+	if err := action(name); err != nil {
+		logger.Warn("节点操作失败", "node", name, "error", err)
+		writeError(w, 404, err.Error())
+		return
+	}
+
+	n, _ := a.Manager.GetNode(name)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(n)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	w.WriteHeader(code)
+	e := ErrResponse{
+		HTTPStatusCode: code,
+		Message:        msg,
+	}
+	_ = json.NewEncoder(w).Encode(e)
+}
+
+func (a *Api) GetEventsHandler(w http.ResponseWriter, r *http.Request) {
+	f, err := parseEventFilter(r)
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+
+	if r.URL.Query().Get("watch") != "true" {
+		events, err := a.Manager.GetEvents(f)
+		if err != nil {
+			writeError(w, 410, err.Error())
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(200)
+		_ = json.NewEncoder(w).Encode(events)
+		return
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	existing, ch, cancel, err := a.Manager.WatchEvents(f)
+	if err != nil {
+		_ = sse.send(0, WatchError, ErrResponse{HTTPStatusCode: 410, Message: err.Error()})
+		return
+	}
+	defer cancel()
+	for _, e := range existing {
+		if err := sse.send(e.Seq, e.Type, e); err != nil {
+			return
+		}
+	}
+	ticker := time.NewTicker(ssePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := sse.send(e.Seq, e.Type, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := sse.ping(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// parseEventFilter 解析查询参数 task, node, type (逗号分隔), since, until (RFC3339) 和 after,
+// 重新连接时请求头 Last-Event-ID 与 after 含义相同
+func parseEventFilter(r *http.Request) (EventFilter, error) {
+	q := r.URL.Query()
+	var f EventFilter
+	if v := q.Get("task"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			return f, fmt.Errorf("无效的任务 id: %v", v)
+		}
+		f.TaskID = id
+	}
+	f.Node = q.Get("node")
+	if v := q.Get("type"); v != "" {
+		f.Types = strings.Split(v, ",")
+	}
+	for name, dst := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if v := q.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return f, fmt.Errorf("无效的时间 %s: %v", name, v)
+			}
+			*dst = t
+		}
+	}
+	after := q.Get("after")
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		after = v
+	}
+	if after != "" {
+		seq, err := strconv.ParseUint(after, 10, 64)
+		if err != nil {
+			return f, fmt.Errorf("无效的事件序号: %v", after)
+		}
+		f.After = seq
+	}
+	return f, nil
+}
+
+// parseTaskQuery 解析任务列表的过滤, 排序和分页参数:
+// state (逗号分隔), name (前缀), image, node, labels (标签选择器), sort, order (asc 或者 desc), limit, cursor
+func parseTaskQuery(r *http.Request) (store.TaskQuery, error) {
+	v := r.URL.Query()
+	q := store.TaskQuery{
+		Name:   v.Get("name"),
+		Image:  v.Get("image"),
+		Node:   v.Get("node"),
+		SortBy: v.Get("sort"),
+		Cursor: v.Get("cursor"),
+	}
+	if states := v.Get("state"); states != "" {
+		for _, name := range strings.Split(states, ",") {
+			s, err := task.ParseState(name)
+			if err != nil {
+				return q, err
+			}
+			q.States = append(q.States, s)
+		}
+	}
+	selector, err := task.ParseSelector(v.Get("labels"))
+	if err != nil {
+		return q, err
+	}
+	q.Selector = selector
+	switch order := v.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		q.Desc = true
+	default:
+		return q, fmt.Errorf("无效的排序方向: %v", order)
+	}
+	if limit := v.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return q, fmt.Errorf("无效的分页大小: %v", limit)
+		}
+		q.Limit = n
+	}
+	return q, q.Validate()
+}
+
+// serveWatch 以 Server-Sent Events 输出对象变化, 消息 id 为 ResourceVersion。
+// 查询参数 resourceVersion 或者请求头 Last-Event-ID 指定从哪个版本之后继续读取,
+// 未指定时先以 ADDED 事件输出所有现有对象; 版本已过期时输出 ERROR 事件后结束。
+// 查询参数 labels 为标签选择器, 只输出标签匹配的对象的变化
+func serveWatch(w http.ResponseWriter, r *http.Request, watch func(from *uint64) ([]WatchEvent, <-chan WatchEvent, func(), error)) {
+	selector, err := task.ParseSelector(r.URL.Query().Get("labels"))
+	if err != nil {
+		writeError(w, 400, err.Error())
+		return
+	}
+	send := func(sse *sseWriter, e WatchEvent) error {
+		if len(selector) > 0 {
+			var obj struct{ Labels map[string]string }
+			if err := json.Unmarshal(e.Object, &obj); err != nil || !selector.Matches(obj.Labels) {
+				return nil
+			}
+		}
+		return sse.send(e.ResourceVersion, e.Type, e)
+	}
+
+	var from *uint64
+	version := r.URL.Query().Get("resourceVersion")
+	if v := r.Header.Get("Last-Event-ID"); v != "" {
+		version = v
+	}
+	if version != "" {
+		v, err := strconv.ParseUint(version, 10, 64)
+		if err != nil {
+			writeError(w, 400, fmt.Sprintf("无效的版本: %v", version))
+			return
+		}
+		from = &v
+	}
+
+	sse, err := newSSEWriter(w)
+	if err != nil {
+		writeError(w, 500, err.Error())
+		return
+	}
+	initial, ch, cancel, err := watch(from)
+	if err != nil {
+		_ = sse.send(0, WatchError, ErrResponse{HTTPStatusCode: 410, Message: err.Error()})
+		return
+	}
+	defer cancel()
+
+	for _, e := range initial {
+		if err := send(sse, e); err != nil {
+			return
+		}
+	}
+	ticker := time.NewTicker(ssePingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case e, ok := <-ch:
+			if !ok {
+				return
+			}
+			if err := send(sse, e); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := sse.ping(); err != nil {
+				return
+			}
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
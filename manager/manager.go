@@ -2,39 +2,81 @@ package manager
 
 import (
 	"bytes"
+	"context"
+	"cube/logging"
 	"cube/node"
 	"cube/scheduler"
 	"cube/store"
 	"cube/task"
+	"cube/tracing"
 	"cube/worker"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/docker/go-connections/nat"
-	"github.com/golang-collections/collections/queue"
 	"github.com/google/uuid"
-	"log"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"net/http"
+	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
+var (
+	logger = logging.Component("manager")
+	tracer = tracing.Tracer("manager")
+)
+
 type Manager struct {
-	Pending queue.Queue
+	Pending *PriorityQueue
 	TaskDb  store.Store
 	EventDb store.Store
-	Workers []string
+	// 定时任务, 工作流和自动扩缩容
+	CronDb       store.Store
+	WorkflowDb   store.Store
+	AutoscalerDb store.Store
+	Workers      []string
 	// worker 对应的任务事件
 	WorkerTaskMap map[string][]uuid.UUID
 	// 任务 对应的 worker
 	TaskWorkerMap map[uuid.UUID]string
 	LastWorker    int
+	// 没有节点满足条件时, 是否驱逐低优先级任务
+	Preemption bool
 
 	workerNodes []*node.Node
-	scheduler   scheduler.Scheduler
+	// nodeMu 保护 workerNodes 中各节点的字段以及 WorkerTaskMap 和 TaskWorkerMap,
+	// 调度器, 指标和 HTTP 接口只读取节点快照
+	nodeMu    sync.Mutex
+	scheduler scheduler.Scheduler
+	// 正在驱逐的节点, 以及驱逐时为任务创建的替代任务, 由 nodeMu 保护
+	draining     map[string]bool
+	replacements map[uuid.UUID]*replacement
+	// 第一轮统计信息采集完成后关闭, 在此之前节点容量为 0, 不进行调度
+	statsReady     chan struct{}
+	statsReadyOnce sync.Once
+	// 无法调度的任务事件
+	backlog   []task.Event
+	backlogMu sync.Mutex
+	// 任务组
+	gangs  []*task.Gang
+	gangMu sync.Mutex
+	pods   []*task.Pod
+	podMu  sync.Mutex
+	// 保护工作流, 定时任务和自动扩缩容存储的读取-修改-写入
+	workflowMu   sync.Mutex
+	cronMu       sync.Mutex
+	autoscalerMu sync.Mutex
+	// 集群事件
+	events *eventLog
+	// 任务和节点的变化, 用于 watch
+	taskWatch *watchHub
+	nodeWatch *watchHub
 }
 
-func New(workers []string, schedulerType string, dbType string) *Manager {
+func New(workers []string, schedulerType string, dbType string, preemption bool) *Manager {
 	workerTaskMap := make(map[string][]uuid.UUID)
 	taskWorkerMap := make(map[uuid.UUID]string)
 
@@ -53,39 +95,89 @@ func New(workers []string, schedulerType string, dbType string) *Manager {
 		s = &scheduler.RoundRobin{Name: "round_robin"}
 	case "e_pvm":
 		s = &scheduler.EPvm{Name: "e_pvm"}
+	case "bin_packing":
+		s = &scheduler.BinPacking{Name: "bin_packing"}
 	default:
 		s = &scheduler.RoundRobin{Name: "round_robin"}
 	}
 
 	m := Manager{
-		Pending:       *queue.New(),
+		Pending:       NewPriorityQueue(),
 		Workers:       workers,
 		WorkerTaskMap: workerTaskMap,
 		TaskWorkerMap: taskWorkerMap,
+		Preemption:    preemption,
 		workerNodes:   nodes,
 		scheduler:     s,
+		draining:      make(map[string]bool),
+		replacements:  make(map[uuid.UUID]*replacement),
+		statsReady:    make(chan struct{}),
+		taskWatch:     newWatchHub(),
+		nodeWatch:     newWatchHub(),
+	}
+	for _, n := range nodes {
+		m.nodeWatch.load(n.Name, watchedNode(n))
 	}
 
 	var ts store.Store
 	var es store.Store
+	var cs store.Store
+	var ws store.Store
+	var as store.Store
+	var ces store.Store
 	switch dbType {
 	case "memory":
 		ts = store.NewInMemoryTaskStore()
 		es = store.NewInMemoryTaskEventStore()
+		cs = store.NewInMemoryCronTaskStore()
+		ws = store.NewInMemoryWorkflowStore()
+		as = store.NewInMemoryAutoscalerStore()
+		ces = store.NewInMemoryClusterEventStore()
 	case "persistent":
 		var err error
 		ts, err = store.NewTaskStore("tasks.db", 0600, "tasks")
 		if err != nil {
-			log.Fatalf("不能创建任务 store: %v", err)
+			logger.Error("不能创建任务 store", "error", err)
+			os.Exit(1)
 		}
 		es, err = store.NewTaskEventStore("event.db", 0600, "events")
 		if err != nil {
-			log.Fatalf("不能创建任务事件 store: %v", err)
+			logger.Error("不能创建任务事件 store", "error", err)
+			os.Exit(1)
+		}
+		cs, err = store.NewCronTaskStore("crontasks.db", 0600, "crontasks")
+		if err != nil {
+			logger.Error("不能创建定时任务 store", "error", err)
+			os.Exit(1)
+		}
+		ws, err = store.NewWorkflowStore("workflows.db", 0600, "workflows")
+		if err != nil {
+			logger.Error("不能创建工作流 store", "error", err)
+			os.Exit(1)
+		}
+		as, err = store.NewAutoscalerStore("autoscalers.db", 0600, "autoscalers")
+		if err != nil {
+			logger.Error("不能创建自动扩缩容 store", "error", err)
+			os.Exit(1)
+		}
+		ces, err = store.NewClusterEventStore("clusterevents.db", 0600, "clusterevents")
+		if err != nil {
+			logger.Error("不能创建集群事件 store", "error", err)
+			os.Exit(1)
 		}
 	}
 
-	m.TaskDb = ts
+	if result, err := ts.List(); err == nil {
+		for _, t := range result.([]*task.Task) {
+			m.taskWatch.load(t.ID.String(), t)
+		}
+	}
+	m.TaskDb = &watchedStore{Store: ts, hub: m.taskWatch}
 	m.EventDb = es
+	m.CronDb = cs
+	m.WorkflowDb = ws
+	m.AutoscalerDb = as
+	m.events = newEventLog(ces)
 
 	return &m
 }
@@ -97,192 +189,386 @@ func (m *Manager) AddTask(te task.Event) {
 func (m *Manager) GetTasks() []*task.Task {
 	taskList, err := m.TaskDb.List()
 	if err != nil {
-		log.Printf("获取任务列表失败: %v\n", err)
+		logger.Error("获取任务列表失败", "error", err)
 		return nil
 	}
 
 	return taskList.([]*task.Task)
 }
 
+// QueryTasks 由任务存储完成过滤, 排序和分页
+func (m *Manager) QueryTasks(q store.TaskQuery) (store.TaskPage, error) {
+	qs, ok := m.TaskDb.(store.TaskQuerier)
+	if !ok {
+		return store.TaskPage{}, errors.New("任务存储不支持查询")
+	}
+	return qs.Query(q)
+}
+
+// StopTasks 停止标签匹配 selector 且尚未结束的任务, 返回请求停止的任务
+func (m *Manager) StopTasks(selector task.Selector) ([]*task.Task, error) {
+	if len(selector) == 0 {
+		return nil, errors.New("没有指定标签选择器")
+	}
+	page, err := m.QueryTasks(store.TaskQuery{Selector: selector})
+	if err != nil {
+		return nil, err
+	}
+	stopped := []*task.Task{}
+	for _, t := range page.Tasks {
+		if t.State == task.Completed || t.State == task.Failed {
+			continue
+		}
+		m.enqueueStop(*t)
+		stopped = append(stopped, t)
+	}
+	logger.Info("按标签停止任务", "selector", selector.String(), "count", len(stopped))
+	return stopped, nil
+}
+
 func (m *Manager) WorkerNodes() []*node.Node {
-	return m.workerNodes
+	return m.nodes()
 }
 
+// SelectWorker 在节点快照上选择节点, 返回的节点为快照
 func (m *Manager) SelectWorker(t task.Task) (*node.Node, error) {
-	candidates := m.scheduler.SelectCandidateNodes(t, m.workerNodes)
-	if candidates == nil {
+	start := time.Now()
+	m.syncNodeTasks()
+	candidates := m.scheduler.SelectCandidateNodes(t, m.nodes())
+	if len(candidates) == 0 {
+		schedulingDuration.WithLabelValues("unschedulable").Observe(time.Since(start).Seconds())
 		msg := fmt.Sprintf("没有可用的候选节点用于任务: %v\n", t.ID)
 		err := errors.New(msg)
 		return nil, err
 	}
 	scores := m.scheduler.Score(t, candidates)
-	log.Printf("节点算分结果: %v\n", scores)
+	logger.Debug("节点算分结果", "task_id", t.ID, "scores", scores)
 	selectNode := m.scheduler.Pick(scores, candidates)
+	schedulingDuration.WithLabelValues("scheduled").Observe(time.Since(start).Seconds())
 
 	return selectNode, nil
 }
 
+// ExplainSchedule 对任务试运行一次调度, 返回各节点过滤结果, 评分明细和最终选择的节点
+func (m *Manager) ExplainSchedule(t task.Task) scheduler.Explanation {
+	m.syncNodeTasks()
+	return scheduler.Explain(m.scheduler, t, m.nodes())
+}
+
+// syncNodeTasks 将各 worker 上未结束的任务同步到节点, 并重新计算节点已分配资源,
+// 在调度, 停止, 失败以及重新调度任务后调用
+func (m *Manager) syncNodeTasks() {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	for _, n := range m.workerNodes {
+		n.Tasks = nil
+		for _, id := range m.WorkerTaskMap[n.Name] {
+			result, err := m.TaskDb.Get(id.String())
+			if err != nil {
+				continue
+			}
+			t, ok := result.(*task.Task)
+			if !ok || t.State == task.Completed || t.State == task.Failed {
+				continue
+			}
+			n.Tasks = append(n.Tasks, t)
+		}
+		n.UpdateAllocated()
+	}
+}
+
 func (m *Manager) UpdateTasks() {
 	for {
 		for {
-			log.Println("从 workers 检测任务更新状态")
+			logger.Debug("从 workers 检测任务更新状态")
 			m.updateTasks()
-			log.Println("任务状态更新完成")
-			log.Println("sleeping for 15 seconds")
+			m.updatePods()
+			m.collectGarbage()
+			logger.Debug("任务状态更新完成, 15 秒后再次检测")
 			time.Sleep(15 * time.Second)
 		}
 	}
 }
 
 func (m *Manager) updateTasks() {
+	finished := false
 	for _, w := range m.Workers {
-		log.Printf("检查 worker %v 用于更新任务状态", w)
+		logger.Debug("检查 worker 用于更新任务状态", "node", w)
 		url := fmt.Sprintf("http://%s/tasks", w)
 		resp, err := http.Get(url)
 		if err != nil {
-			log.Printf("连接失败: %v, 错误: %v\n", w, err)
+			logger.Warn("连接 worker 失败", "node", w, "error", err)
+			continue
 		}
 
 		if resp.StatusCode != http.StatusOK {
-			log.Printf("发送请求错误: %v\n", err)
+			logger.Warn("获取 worker 任务列表错误", "node", w, "status", resp.StatusCode)
 		}
 
 		d := json.NewDecoder(resp.Body)
 		var tasks []*task.Task
 		if err = d.Decode(&tasks); err != nil {
-			fmt.Printf("json 解码失败: %v\n", err.Error())
+			logger.Error("json 解码失败", "node", w, "error", err)
 		}
 
-		m.WorkerTaskMap[w] = []uuid.UUID{}
+		ids := []uuid.UUID{}
 		for _, t := range tasks {
-			log.Printf("更新任务状态: %v\n", t.ID)
+			logger.Debug("更新任务状态", "task_id", t.ID, "node", w)
 
 			result, err := m.TaskDb.Get(t.ID.String())
 			if err != nil {
-				log.Printf("[manager] %s\n", err)
+				logger.Warn("获取任务失败", "task_id", t.ID, "error", err)
 				continue
 			}
 			taskPersisted, ok := result.(*task.Task)
 			if !ok {
-				log.Printf("%v 不能转换为 task.Task 类型\n", result)
+				logger.Error("不能转换为 task.Task 类型", "task_id", t.ID)
 				continue
 			}
 
-			m.WorkerTaskMap[w] = append(m.WorkerTaskMap[w], t.ID)
-			m.TaskWorkerMap[t.ID] = w
+			ids = append(ids, t.ID)
 
 			if taskPersisted.State != t.State {
-				taskPersisted.State = t.State
+				if t.State == task.Completed || t.State == task.Failed {
+					finished = true
+				}
+				m.mergeTransitions(taskPersisted, t)
 			}
 
 			taskPersisted.StartTime = t.StartTime
 			taskPersisted.FinishTime = t.FinishTime
 			taskPersisted.ContainerID = t.ContainerID
 			taskPersisted.HostPorts = t.HostPorts
+			taskPersisted.ContainerRemoved = t.ContainerRemoved
 
 			_ = m.TaskDb.Put(taskPersisted.ID.String(), taskPersisted)
 		}
+		m.setWorkerTasks(w, ids)
+	}
+	m.syncNodeTasks()
+	if finished {
+		m.retryBacklog("任务结束释放资源")
 	}
 }
 
+// mergeTransitions worker 上报的 Generation 小于 manager 的记录时, worker 尚未处理 manager 的最新变更,
+// 忽略上报的旧状态; 否则以 worker 上报的状态和转换历史为准, 为新增的转换记录集群事件
+func (m *Manager) mergeTransitions(persisted *task.Task, reported *task.Task) {
+	if reported.Generation < persisted.Generation {
+		logger.Debug("worker 尚未处理最新变更, 忽略上报的状态", "task_id", persisted.ID,
+			"state", reported.State, "generation", reported.Generation, "expected", persisted.Generation)
+		return
+	}
+	n := 0
+	for n < len(persisted.Transitions) && n < len(reported.Transitions) && persisted.Transitions[n].Equal(reported.Transitions[n]) {
+		n++
+	}
+	persisted.State = reported.State
+	persisted.Reason = reported.Reason
+	persisted.Transitions = reported.Transitions
+	m.recordTransitions(persisted, n)
+}
+
 func (m *Manager) ProcessTasks() {
+	<-m.statsReady
 	for {
-		log.Println("读取 Pending 任务事件队列")
+		logger.Debug("读取 Pending 任务事件队列")
 		m.SendWork()
-		log.Println("sleeping for 10 seconds")
+		m.processGangs()
+		m.processPods()
+		m.processWorkflows()
+		m.processCronTasks()
+		m.processAutoscalers()
 		time.Sleep(10 * time.Second)
 	}
 }
 
 func (m *Manager) SendWork() {
-	if m.Pending.Len() > 0 {
-		e := m.Pending.Dequeue()
-		te := e.(task.Event)
+	if te, ok := m.Pending.Dequeue(); ok {
 		err := m.EventDb.Put(te.ID.String(), &te)
 		if err != nil {
-			log.Printf("存储任务事件 %v, 失败: %v\n", te.ID.String(), err)
+			logger.Error("存储任务事件失败", "event_id", te.ID, "task_id", te.Task.ID, "error", err)
 			return
 		}
-		log.Printf("从 Pending 任务事件队列, 取出任务事件: %v\n", te)
+		logger.Info("从 Pending 任务事件队列取出任务事件", "event_id", te.ID, "task_id", te.Task.ID, "state", te.State)
+
+		parent := tracing.Extract(context.Background(), te.TraceContext)
+		_, pending := tracer.Start(parent, "manager.pending", trace.WithTimestamp(te.Timestamp))
+		pending.End()
+		ctx, span := tracer.Start(parent, "manager.process_event", trace.WithAttributes(
+			attribute.String("task.id", te.Task.ID.String()),
+			attribute.String("event.id", te.ID.String()),
+			attribute.String("event.state", te.State.String()),
+		))
+		defer span.End()
 
 		// worker 已调度过该任务
-		taskWorker, ok := m.TaskWorkerMap[te.Task.ID]
+		taskWorker, ok := m.taskWorker(te.Task.ID)
 		if ok {
 			result, err := m.TaskDb.Get(te.Task.ID.String())
 			if err != nil {
-				log.Printf("不能调度任务, 失败: %v\n", err)
+				logger.Error("获取任务失败", "task_id", te.Task.ID, "error", err)
 				return
 			}
 			persistedTask, ok := result.(*task.Task)
 			if !ok {
-				log.Println("不能转换为任务类型")
+				logger.Error("不能转换为 task.Task 类型", "task_id", te.Task.ID)
 				return
 			}
-			if te.State == task.Completed && task.ValidateTransitions(persistedTask.State, te.State) {
-				m.stopTask(taskWorker, te.Task.ID.String())
+			if te.State == task.Completed && task.ValidateTransitions(persistedTask.State, task.Stopping) {
+				_ = m.stopTask(ctx, taskWorker, te.Task.ID.String())
 				return
 			}
 
-			log.Printf("无效请求：存在任务 %s 不能从状态 %v 转换为完成状态\n", persistedTask.ID.String(), persistedTask.State)
+			logger.Warn("无效请求: 任务不能从当前状态转换为完成状态", "task_id", persistedTask.ID, "state", persistedTask.State)
 			return
 		}
 
-		t := te.Task
-		w, err := m.SelectWorker(t)
-		if err != nil {
-			log.Printf("选择 worker 用于任务: %s, 错误: %v\n", t.ID, err)
+		// 停止尚未调度的任务
+		if te.State == task.Completed {
+			if m.removeFromBacklog(te.Task.ID) {
+				t := te.Task
+				if result, err := m.TaskDb.Get(t.ID.String()); err == nil {
+					t = *result.(*task.Task)
+				}
+				_ = m.transition(&t, task.Completed, "")
+				_ = m.TaskDb.Put(t.ID.String(), &t)
+				logger.Info("从积压列表移除任务", "task_id", t.ID)
+				return
+			}
+			logger.Warn("无效请求: 任务未被调度, 不能停止", "task_id", te.Task.ID)
+			return
 		}
-		log.Printf("选择 worker: %s, 执行任务: %s\n", w.Name, t.ID)
-		m.WorkerTaskMap[w.Name] = append(m.WorkerTaskMap[w.Name], t.ID)
-		m.TaskWorkerMap[t.ID] = w.Name
-
-		t.State = task.Scheduled
-		_ = m.TaskDb.Put(t.ID.String(), &t)
 
-		data, err := json.Marshal(te)
-		if err != nil {
-			log.Printf("json 编码错误: %v\n", te)
+		t := te.Task
+		_, selectSpan := tracer.Start(ctx, "scheduler.select_worker")
+		w, err := m.SelectWorker(t)
+		if err != nil && m.Preemption {
+			logger.Info("没有可用节点, 尝试抢占", "task_id", t.ID, "error", err)
+			selectSpan.AddEvent("preempt")
+			w, err = m.preempt(ctx, t)
 		}
-
-		url := fmt.Sprintf("http://%s/tasks", w.Name)
-		resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
 		if err != nil {
-			log.Printf("连接失败: %v, 错误: %v\n", w, err)
-			m.Pending.Enqueue(te)
+			tracing.RecordError(selectSpan, err)
+			selectSpan.End()
+			logger.Warn("选择 worker 失败", "task_id", t.ID, "error", err)
+			m.addToBacklog(te)
 			return
 		}
-		d := json.NewDecoder(resp.Body)
-		if resp.StatusCode != http.StatusCreated {
-			e := worker.ErrResponse{}
-			err := d.Decode(&e)
-			if err != nil {
-				fmt.Printf("json 解码失败: %v\n", err.Error())
-				return
-			}
-			log.Printf("响应错误, code:%v, message:%v\n", e.HTTPStatusCode, e.Message)
-			return
+		selectSpan.SetAttributes(attribute.String("node", w.Name))
+		selectSpan.End()
+
+		// 重新加入队列的任务事件保留原有的 trace 上下文
+		dispatched := te
+		dispatched.TraceContext = tracing.Inject(ctx)
+		err = m.dispatch(dispatched, w)
+		if errors.Is(err, errWorkerUnreachable) {
+			m.Pending.Enqueue(te)
 		}
+	} else {
+		logger.Debug("当前 Pending 任务事件队列没有任务事件")
+	}
+}
+
+var errWorkerUnreachable = errors.New("连接 worker 失败")
+
+// dispatch 记录任务与所选 worker 的对应关系并将任务事件发送到 worker, worker 未接受任务时撤销对应关系,
+// 其中连接 worker 失败时返回 errWorkerUnreachable
+func (m *Manager) dispatch(te task.Event, w *node.Node) (err error) {
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), te.TraceContext), "manager.dispatch", trace.WithAttributes(
+		attribute.String("task.id", te.Task.ID.String()),
+		attribute.String("node", w.Name),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	t := te.Task
+	if err := m.transition(&t, task.Scheduled, ""); err != nil {
+		logger.Error("不能调度任务", "task_id", t.ID, "error", err)
+		return err
+	}
+	t.Generation++
+	logger.Info("选择 worker 执行任务", "task_id", t.ID, "event_id", te.ID, "node", w.Name)
+	m.assign(t.ID, w.Name)
 
-		t = task.Task{}
-		err = d.Decode(&t)
+	t.Node = w.Name
+	t.SchedulingErrors = nil
+	_ = m.TaskDb.Put(t.ID.String(), &t)
+	te.Task = t
+	te.TraceContext = tracing.Inject(ctx)
+
+	data, err := json.Marshal(te)
+	if err != nil {
+		logger.Error("json 编码错误", "event_id", te.ID, "task_id", t.ID, "error", err)
+	}
+
+	url := fmt.Sprintf("http://%s/tasks", w.Name)
+	start := time.Now()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tracing.Client.Do(req)
+	if err != nil {
+		dispatchDuration.WithLabelValues(w.Name, "unreachable").Observe(time.Since(start).Seconds())
+		logger.Warn("连接 worker 失败", "task_id", t.ID, "node", w.Name, "error", err)
+		m.unassign(t.ID, w.Name)
+		return errWorkerUnreachable
+	}
+	d := json.NewDecoder(resp.Body)
+	if resp.StatusCode != http.StatusCreated {
+		dispatchDuration.WithLabelValues(w.Name, "error").Observe(time.Since(start).Seconds())
+		e := worker.ErrResponse{}
+		err := d.Decode(&e)
 		if err != nil {
-			fmt.Printf("json 解码失败: %v\n", err.Error())
-			return
+			logger.Error("json 解码失败", "task_id", t.ID, "node", w.Name, "error", err)
+			m.unassign(t.ID, w.Name)
+			return err
 		}
-		w.TaskCount++
+		logger.Warn("worker 响应错误", "task_id", t.ID, "node", w.Name, "status", e.HTTPStatusCode, "message", e.Message)
+		m.unassign(t.ID, w.Name)
+		return errors.New(e.Message)
+	}
 
-		log.Printf("%#v\n", t)
-	} else {
-		log.Println("当前 Pending 任务事件队列，没有任务事件")
+	dispatchDuration.WithLabelValues(w.Name, "success").Observe(time.Since(start).Seconds())
+
+	t = task.Task{}
+	err = d.Decode(&t)
+	if err != nil {
+		logger.Error("json 解码失败", "task_id", te.Task.ID, "node", w.Name, "error", err)
+		return err
+	}
+	m.syncNodeTasks()
+
+	logger.Debug("任务已下发", "task_id", t.ID, "node", w.Name, "state", t.State)
+	return nil
+}
+
+func (m *Manager) assign(id uuid.UUID, worker string) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	m.WorkerTaskMap[worker] = append(m.WorkerTaskMap[worker], id)
+	m.TaskWorkerMap[id] = worker
+}
+
+func (m *Manager) unassign(id uuid.UUID, worker string) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	delete(m.TaskWorkerMap, id)
+	ids := m.WorkerTaskMap[worker]
+	for i, tid := range ids {
+		if tid == id {
+			m.WorkerTaskMap[worker] = append(ids[:i], ids[i+1:]...)
+			break
+		}
 	}
 }
 
 func (m *Manager) DoHealthChecks() {
 	for {
-		log.Println("执行任务健康检查")
+		logger.Debug("执行任务健康检查")
 		m.doHealthChecks()
-		log.Println("任务健康检查完成")
-		log.Println("sleeping for 10 seconds")
+		logger.Debug("任务健康检查完成")
 		time.Sleep(60 * time.Second)
 	}
 }
@@ -290,111 +576,167 @@ func (m *Manager) DoHealthChecks() {
 func (m *Manager) doHealthChecks() {
 	tasks := m.GetTasks()
 	for _, t := range tasks {
-		if t.State == task.Running && t.RestartCount < 3 {
+		// Pod 成员由 Pod 整体重启, 工作流步骤由工作流重试, 定时任务的运行结果记录在运行历史中, 不重启
+		if t.PodID != uuid.Nil || t.WorkflowID != uuid.Nil || t.CronTaskID != uuid.Nil {
+			continue
+		}
+		// 没有配置健康检查的任务不检查
+		if t.State == task.Running && t.RestartCount < 3 && t.Healthcheck != "" {
 			err := m.checkTaskHealth(*t)
 			if err != nil {
-				m.restartTask(t)
+				healthChecks.WithLabelValues("failure").Inc()
+				m.restartTask(t, "HealthCheckFailed")
+			} else {
+				healthChecks.WithLabelValues("success").Inc()
 			}
 		} else if t.State == task.Failed && t.RestartCount < 3 {
-			m.restartTask(t)
+			m.restartTask(t, t.Reason)
 		}
 	}
 }
 
 func (m *Manager) checkTaskHealth(t task.Task) error {
-	log.Printf("调用任务: %s 健康检测: %s\n", t.ID, t.Healthcheck)
-
-	w := m.TaskWorkerMap[t.ID]
-	hostPort := func(ports nat.PortMap) *string {
-		for k, _ := range ports {
-			return &ports[k][0].HostPort
+	w, _ := m.taskWorker(t.ID)
+	hostPort := func(ports nat.PortMap) string {
+		for _, bindings := range ports {
+			if len(bindings) > 0 && bindings[0].HostPort != "" {
+				return bindings[0].HostPort
+			}
 		}
-		return nil
+		return ""
 	}(t.HostPorts)
+	if hostPort == "" {
+		msg := fmt.Sprintf("任务 %s 没有发布到节点的端口, 不能执行健康检查", t.ID)
+		logger.Warn(msg, "task_id", t.ID)
+		return errors.New(msg)
+	}
 	wUrl := strings.Split(w, ":")
-	url := fmt.Sprintf("http://%s:%s%s", wUrl[0], *hostPort, t.Healthcheck)
-	log.Printf("调用任务: %s 健康检测: %s\n", t.ID, url)
+	url := fmt.Sprintf("http://%s:%s%s", wUrl[0], hostPort, t.Healthcheck)
+	logger.Debug("调用任务健康检查", "task_id", t.ID, "node", w, "url", url)
 	resp, err := http.Get(url)
 	if err != nil {
 		msg := fmt.Sprintf("连接健康检查服务失败: %s", url)
-		log.Println(msg)
+		logger.Warn(msg, "task_id", t.ID, "error", err)
 		return errors.New(msg)
 	}
+	defer resp.Body.Close()
 	if resp.StatusCode != http.StatusOK {
 		msg := fmt.Sprintf("健康检查服务错误, 任务: %s", t.ID)
-		log.Println(msg)
+		logger.Warn(msg, "task_id", t.ID, "status", resp.StatusCode)
 		return errors.New(msg)
 	}
-	log.Printf("任务 %s 健康检查服务响应: %v\n", t.ID, resp.Status)
+	logger.Debug("任务健康检查服务响应", "task_id", t.ID, "status", resp.Status)
 
 	return nil
 }
 
-func (m *Manager) restartTask(t *task.Task) {
-	w := m.TaskWorkerMap[t.ID]
-	t.State = task.Scheduled
+func (m *Manager) restartTask(t *task.Task, reason string) {
+	w, _ := m.taskWorker(t.ID)
+	ctx, span := tracer.Start(context.Background(), "manager.restart_task", trace.WithAttributes(
+		attribute.String("task.id", t.ID.String()),
+		attribute.String("node", w),
+		attribute.String("reason", reason),
+	))
+	defer span.End()
+	if err := m.transition(t, task.Restarting, reason); err != nil {
+		logger.Error("不能重启任务", "task_id", t.ID, "error", err)
+		return
+	}
+	_ = m.transition(t, task.Scheduled, "")
+	t.Generation++
 	t.RestartCount++
+	taskRestarts.WithLabelValues(restartReason(reason)).Inc()
 	_ = m.TaskDb.Put(t.ID.String(), t)
+	m.syncNodeTasks()
 
 	te := task.Event{
-		ID:        uuid.New(),
-		State:     task.Running,
-		Timestamp: time.Now(),
-		Task:      *t,
+		ID:           uuid.New(),
+		State:        task.Running,
+		Timestamp:    time.Now(),
+		Task:         *t,
+		TraceContext: tracing.Inject(ctx),
 	}
 
 	data, err := json.Marshal(te)
 	if err != nil {
-		log.Printf("json 编码错误: %v\n", te)
+		logger.Error("json 编码错误", "event_id", te.ID, "task_id", t.ID, "error", err)
 	}
 
 	url := fmt.Sprintf("http://%s/tasks", w)
-	resp, err := http.Post(url, "application/json", bytes.NewBuffer(data))
+	req, _ := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := tracing.Client.Do(req)
 	if err != nil {
-		log.Printf("连接失败: %v, 错误: %v\n", w, err)
+		tracing.RecordError(span, err)
+		logger.Warn("连接 worker 失败, 重新加入 Pending 队列", "task_id", t.ID, "node", w, "error", err)
 		m.Pending.Enqueue(te)
 		return
 	}
+	defer resp.Body.Close()
 	d := json.NewDecoder(resp.Body)
 	if resp.StatusCode != http.StatusCreated {
 		e := worker.ErrResponse{}
 		err := d.Decode(&e)
 		if err != nil {
-			fmt.Printf("json 解码失败: %v\n", err.Error())
+			tracing.RecordError(span, err)
+			logger.Error("json 解码失败", "task_id", t.ID, "node", w, "error", err)
 			return
 		}
-		log.Printf("响应错误, code:%v, message:%v\n", e.HTTPStatusCode, e.Message)
+		tracing.RecordError(span, errors.New(e.Message))
+		logger.Warn("worker 响应错误", "task_id", t.ID, "node", w, "status", e.HTTPStatusCode, "message", e.Message)
 		return
 	}
 
 	newT := task.Task{}
 	err = d.Decode(&newT)
 	if err != nil {
-		fmt.Printf("json 解码失败: %v\n", err.Error())
+		logger.Error("json 解码失败", "task_id", t.ID, "node", w, "error", err)
 		return
 	}
-	log.Printf("%#v\n", newT)
+	logger.Info("任务已重启", "task_id", newT.ID, "node", w, "reason", reason, "restart_count", newT.RestartCount)
 }
 
-func (m *Manager) stopTask(worker string, taskID string) {
-	client := &http.Client{}
-	url := fmt.Sprintf("http://%s/tasks/%s", worker, taskID)
-	req, err := http.NewRequest("DELETE", url, nil)
+// stopTask 请求 worker 停止任务, 同时下发新的 Generation, ctx 为调用方的 trace 上下文
+func (m *Manager) stopTask(ctx context.Context, worker string, taskID string) (err error) {
+	ctx, span := tracer.Start(ctx, "manager.stop_task", trace.WithAttributes(
+		attribute.String("task.id", taskID),
+		attribute.String("node", worker),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	var generation int64
+	if result, err := m.TaskDb.Get(taskID); err == nil {
+		generation = result.(*task.Task).Generation + 1
+	}
+	url := fmt.Sprintf("http://%s/tasks/%s?generation=%d", worker, taskID, generation)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
 	if err != nil {
-		log.Printf("创建停止任务 %s 请求, 错误： %v\n", taskID, err)
-		return
+		logger.Error("创建停止任务请求失败", "task_id", taskID, "node", worker, "error", err)
+		return err
 	}
 
-	resp, err := client.Do(req)
+	resp, err := tracing.Client.Do(req)
 	if err != nil {
-		log.Printf("连接失败: %v, 错误: %v\n", url, err)
-		return
+		logger.Warn("连接 worker 失败", "task_id", taskID, "node", worker, "error", err)
+		return err
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != 204 {
-		log.Printf("请求响应错误: %v", err)
-		return
+		logger.Warn("停止任务请求响应错误", "task_id", taskID, "node", worker, "status", resp.StatusCode)
+		return fmt.Errorf("停止任务 %s 响应错误: %d", taskID, resp.StatusCode)
 	}
 
-	log.Printf("停止任务请求已发送 %s\n", taskID)
+	if result, err := m.TaskDb.Get(taskID); err == nil {
+		t := result.(*task.Task)
+		_ = m.transition(t, task.Stopping, "")
+		t.Generation = generation
+		_ = m.TaskDb.Put(taskID, t)
+	}
+	m.syncNodeTasks()
+	logger.Info("停止任务请求已发送", "task_id", taskID, "node", worker)
+	return nil
 }
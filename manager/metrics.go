@@ -0,0 +1,85 @@
+package manager
+
+import (
+	"cube/task"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"strings"
+)
+
+var (
+	registry       = prometheus.NewRegistry()
+	factory        = promauto.With(registry)
+	metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	pendingQueueDepth = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_manager_pending_queue_depth", Help: "Pending 队列中的任务事件数"})
+	backlogSize       = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_manager_backlog_size", Help: "积压列表中无法调度的任务数"})
+	tasksByState      = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_manager_tasks", Help: "各状态的任务数"}, []string{"state"})
+
+	// 耗时直方图的桶上限, 单位为秒
+	durationBuckets    = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+	schedulingDuration = factory.NewHistogramVec(prometheus.HistogramOpts{Name: "cube_manager_scheduling_duration_seconds",
+		Help: "为任务选择节点的耗时", Buckets: durationBuckets}, []string{"result"})
+	dispatchDuration = factory.NewHistogramVec(prometheus.HistogramOpts{Name: "cube_manager_dispatch_duration_seconds",
+		Help: "将任务下发到 worker 的耗时", Buckets: durationBuckets}, []string{"worker", "result"})
+	taskRestarts = factory.NewCounterVec(prometheus.CounterOpts{Name: "cube_manager_task_restarts_total", Help: "manager 重启任务的次数"}, []string{"reason"})
+	healthChecks = factory.NewCounterVec(prometheus.CounterOpts{Name: "cube_manager_health_checks_total", Help: "任务健康检查次数"}, []string{"result"})
+
+	nodeReady           = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_ready", Help: "节点统计信息是否未过期"}, []string{"node"})
+	nodeCpuUsage        = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_cpu_usage_ratio", Help: "节点 CPU 使用率"}, []string{"node"})
+	nodeCpuCores        = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_cpu_cores", Help: "节点 CPU 核数"}, []string{"node"})
+	nodeCpuAllocated    = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_cpu_allocated_cores", Help: "节点已分配的 CPU 核数"}, []string{"node"})
+	nodeMemory          = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_memory_kilobytes", Help: "节点内存总量"}, []string{"node"})
+	nodeMemoryAllocated = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_memory_allocated_kilobytes", Help: "节点已分配的内存"}, []string{"node"})
+	nodeDisk            = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_disk_bytes", Help: "节点磁盘总量"}, []string{"node"})
+	nodeDiskAllocated   = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_disk_allocated_bytes", Help: "节点已分配的磁盘"}, []string{"node"})
+	nodeTasks           = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_node_tasks", Help: "节点上未结束的任务数"}, []string{"node"})
+)
+
+// restartReason 取原因中冒号前的部分作为指标标签, 避免错误信息导致标签取值过多
+func restartReason(reason string) string {
+	if i := strings.Index(reason, ":"); i >= 0 {
+		reason = reason[:i]
+	}
+	if reason == "" {
+		return "Unknown"
+	}
+	return reason
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// collectMetrics 在输出指标前更新队列长度, 任务状态和节点统计等瞬时值
+func (m *Manager) collectMetrics() {
+	pendingQueueDepth.Set(float64(m.Pending.Len()))
+	m.backlogMu.Lock()
+	backlogSize.Set(float64(len(m.backlog)))
+	m.backlogMu.Unlock()
+
+	tasksByState.Reset()
+	counts := make(map[task.State]int)
+	for _, t := range m.GetTasks() {
+		counts[t.State]++
+	}
+	for state, n := range counts {
+		tasksByState.WithLabelValues(state.String()).Set(float64(n))
+	}
+
+	for _, n := range m.nodes() {
+		nodeReady.WithLabelValues(n.Name).Set(boolValue(!n.Stale))
+		nodeCpuUsage.WithLabelValues(n.Name).Set(n.CpuUsage)
+		nodeCpuCores.WithLabelValues(n.Name).Set(float64(n.Cores))
+		nodeCpuAllocated.WithLabelValues(n.Name).Set(n.CpuAllocated)
+		nodeMemory.WithLabelValues(n.Name).Set(float64(n.Memory))
+		nodeMemoryAllocated.WithLabelValues(n.Name).Set(float64(n.MemoryAllocated))
+		nodeDisk.WithLabelValues(n.Name).Set(float64(n.Disk))
+		nodeDiskAllocated.WithLabelValues(n.Name).Set(float64(n.DiskAllocated))
+		nodeTasks.WithLabelValues(n.Name).Set(float64(n.TaskCount))
+	}
+}
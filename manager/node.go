@@ -0,0 +1,291 @@
+package manager
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	// 驱逐时等待替代任务运行的最长时间
+	drainTimeout      = 5 * time.Minute
+	drainPollInterval = 5 * time.Second
+)
+
+// nodes 返回各节点的快照
+func (m *Manager) nodes() []*node.Node {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	nodes := make([]*node.Node, 0, len(m.workerNodes))
+	for _, n := range m.workerNodes {
+		nodes = append(nodes, n.Snapshot())
+	}
+	return nodes
+}
+
+// GetNode 返回节点的快照
+func (m *Manager) GetNode(name string) (*node.Node, error) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	n, err := m.workerNode(name)
+	if err != nil {
+		return nil, err
+	}
+	return n.Snapshot(), nil
+}
+
+// workerNode 调用方需持有 nodeMu
+func (m *Manager) workerNode(name string) (*node.Node, error) {
+	for _, n := range m.workerNodes {
+		if n.Name == name {
+			return n, nil
+		}
+	}
+	return nil, fmt.Errorf("节点 %s 不存在", name)
+}
+
+// updateNode 持有 nodeMu 修改节点, 并发布修改后的节点
+func (m *Manager) updateNode(name string, update func(n *node.Node)) error {
+	m.nodeMu.Lock()
+	n, err := m.workerNode(name)
+	if err != nil {
+		m.nodeMu.Unlock()
+		return err
+	}
+	update(n)
+	snapshot := n.Snapshot()
+	m.nodeMu.Unlock()
+
+	m.publishNode(snapshot)
+	return nil
+}
+
+func (m *Manager) taskWorker(id uuid.UUID) (string, bool) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	w, ok := m.TaskWorkerMap[id]
+	return w, ok
+}
+
+// workerTasks 返回 worker 上任务 ID 的副本
+func (m *Manager) workerTasks(name string) []uuid.UUID {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	return append([]uuid.UUID(nil), m.WorkerTaskMap[name]...)
+}
+
+// setWorkerTasks 按 worker 上报的任务列表更新任务与 worker 的对应关系
+func (m *Manager) setWorkerTasks(name string, ids []uuid.UUID) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	m.WorkerTaskMap[name] = ids
+	for _, id := range ids {
+		m.TaskWorkerMap[id] = name
+	}
+}
+
+func (m *Manager) CordonNode(name string) error {
+	err := m.updateNode(name, func(n *node.Node) {
+		n.Unschedulable = true
+	})
+	if err != nil {
+		return err
+	}
+	m.recordNodeEvent(EventNodeCordoned, name, fmt.Sprintf("节点 %s 已禁止调度", name))
+	logger.Info("节点已禁止调度", "node", name)
+	return nil
+}
+
+func (m *Manager) UncordonNode(name string) error {
+	err := m.updateNode(name, func(n *node.Node) {
+		n.Unschedulable = false
+	})
+	if err != nil {
+		return err
+	}
+	m.recordNodeEvent(EventNodeUncordoned, name, fmt.Sprintf("节点 %s 已恢复调度", name))
+	logger.Info("节点已恢复调度", "node", name)
+	m.retryBacklog(fmt.Sprintf("节点 %s 恢复调度", name))
+	return nil
+}
+
+// DrainNode 禁止节点调度, 并在后台将节点上的任务逐个迁移到其他节点。节点正在驱逐时不重复驱逐
+func (m *Manager) DrainNode(name string) error {
+	if err := m.CordonNode(name); err != nil {
+		return err
+	}
+
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	if m.draining[name] {
+		logger.Info("节点正在驱逐", "node", name)
+		return nil
+	}
+	m.draining[name] = true
+	go m.drainNode(name)
+	return nil
+}
+
+// drainNode 每次迁移一个任务: 先在其他节点启动替代任务, 替代任务运行后再停止原任务,
+// 保证迁移过程中服务可用。已创建过替代任务的任务不再创建, 只等待原来的替代任务运行
+func (m *Manager) drainNode(name string) {
+	defer func() {
+		m.nodeMu.Lock()
+		delete(m.draining, name)
+		m.nodeMu.Unlock()
+	}()
+
+	for _, id := range m.workerTasks(name) {
+		result, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+		t := result.(*task.Task)
+		if t.State != task.Scheduled && t.State != task.Running {
+			m.forgetReplacement(t.ID)
+			continue
+		}
+
+		r := m.replacement(t.ID)
+		if r.stopRequested {
+			continue
+		}
+		if r.ID == uuid.Nil {
+			r.ID = m.rescheduleTask(t)
+			m.setReplacement(t.ID, r)
+			logger.Info("驱逐节点: 创建替代任务", "node", name, "task_id", t.ID, "replacement_id", r.ID)
+		}
+		if !m.waitForRunning(r.ID, drainTimeout) {
+			logger.Warn("驱逐节点中止: 替代任务未能按时运行", "node", name, "replacement_id", r.ID, "timeout", drainTimeout)
+			return
+		}
+		m.enqueueStop(*t)
+		r.stopRequested = true
+		m.setReplacement(t.ID, r)
+	}
+	m.recordNodeEvent(EventNodeDrained, name, fmt.Sprintf("节点 %s 驱逐完成", name))
+	logger.Info("节点驱逐完成", "node", name)
+}
+
+// replacement 驱逐时为任务创建的替代任务, 以及是否已请求停止原任务
+type replacement struct {
+	ID            uuid.UUID
+	stopRequested bool
+}
+
+func (m *Manager) replacement(id uuid.UUID) replacement {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	if r, ok := m.replacements[id]; ok {
+		return *r
+	}
+	return replacement{}
+}
+
+func (m *Manager) setReplacement(id uuid.UUID, r replacement) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	m.replacements[id] = &r
+}
+
+// forgetReplacement 原任务结束或者停止后不再需要记录替代任务
+func (m *Manager) forgetReplacement(id uuid.UUID) {
+	m.nodeMu.Lock()
+	defer m.nodeMu.Unlock()
+	delete(m.replacements, id)
+}
+
+// rescheduleTask 以新 ID 复制任务并加入 Pending 队列, 返回新任务 ID
+func (m *Manager) rescheduleTask(t *task.Task) uuid.UUID {
+	newTask := *t
+	newTask.ID = uuid.New()
+	newTask.State = task.Pending
+	newTask.Transitions = nil
+	newTask.Reason = ""
+	newTask.Node = ""
+	newTask.ContainerID = ""
+	newTask.HostPorts = nil
+	newTask.RestartCount = 0
+	newTask.StartTime = time.Time{}
+	newTask.FinishTime = time.Time{}
+
+	m.AddTask(task.Event{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      newTask,
+	})
+	return newTask.ID
+}
+
+func (m *Manager) waitForRunning(id uuid.UUID, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		result, err := m.TaskDb.Get(id.String())
+		if err == nil && result.(*task.Task).State == task.Running {
+			return true
+		}
+		time.Sleep(drainPollInterval)
+	}
+	return false
+}
+
+func (m *Manager) enqueueStop(t task.Task) {
+	te := task.Event{
+		ID:        uuid.New(),
+		State:     task.Completed,
+		Timestamp: time.Now(),
+		Task:      t,
+	}
+	m.AddTask(te)
+	m.recordEvent(EventTaskStopRequested, "", fmt.Sprintf("请求停止任务 %s", t.Name), t.ID, t.Node)
+	logger.Info("添加停止任务事件", "event_id", te.ID, "task_id", t.ID)
+}
+
+// markNodeTasksLost 节点失联时将其上未结束的任务标记为 Lost, 节点恢复后按 worker 上报的状态更新
+func (m *Manager) markNodeTasksLost(name string) {
+	for _, id := range m.workerTasks(name) {
+		result, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+		t := result.(*task.Task)
+		if !task.ValidateTransitions(t.State, task.Lost) || t.State == task.Lost {
+			continue
+		}
+		_ = m.transition(t, task.Lost, "NodeLost")
+		_ = m.TaskDb.Put(t.ID.String(), t)
+		logger.Warn("节点失联, 任务标记为 Lost", "node", name, "task_id", t.ID)
+	}
+}
+
+func (m *Manager) AddTaint(name string, taint node.Taint) error {
+	return m.updateNode(name, func(n *node.Node) {
+		for i, existing := range n.Taints {
+			if existing.Key == taint.Key && existing.Effect == taint.Effect {
+				n.Taints[i] = taint
+				return
+			}
+		}
+		n.Taints = append(n.Taints, taint)
+	})
+}
+
+func (m *Manager) RemoveTaint(name string, key string) error {
+	err := m.updateNode(name, func(n *node.Node) {
+		var taints []node.Taint
+		for _, existing := range n.Taints {
+			if existing.Key != key {
+				taints = append(taints, existing)
+			}
+		}
+		n.Taints = taints
+	})
+	if err != nil {
+		return err
+	}
+	m.retryBacklog(fmt.Sprintf("节点 %s 移除污点 %s", name, key))
+	return nil
+}
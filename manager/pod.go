@@ -0,0 +1,281 @@
+package manager
+
+import (
+	"context"
+	"cube/node"
+	"cube/task"
+	"cube/tracing"
+	"fmt"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"time"
+)
+
+// Pod 成员失败后整体重启的最大次数
+const maxPodRestarts = 3
+
+func (m *Manager) AddPod(p task.Pod) task.Pod {
+	if p.ID == uuid.Nil {
+		p.ID = uuid.New()
+	}
+	p.State = task.Pending
+	p.RestartCount = 0
+
+	m.podMu.Lock()
+	defer m.podMu.Unlock()
+	m.pods = append(m.pods, &p)
+	return p
+}
+
+func (m *Manager) GetPods() []task.Pod {
+	m.podMu.Lock()
+	defer m.podMu.Unlock()
+
+	pods := make([]task.Pod, 0, len(m.pods))
+	for _, p := range m.pods {
+		pods = append(pods, *p)
+	}
+	return pods
+}
+
+func (m *Manager) getPod(id uuid.UUID) (*task.Pod, error) {
+	for _, p := range m.pods {
+		if p.ID == id {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("Pod %s 不存在", id)
+}
+
+// StopPod 停止 Pod 的所有成员, 先停止其他成员, 最后停止持有网络命名空间的第一个成员
+func (m *Manager) StopPod(id uuid.UUID) error {
+	m.podMu.Lock()
+	p, err := m.getPod(id)
+	if err != nil {
+		m.podMu.Unlock()
+		return err
+	}
+	state, nodeName, ids := p.State, p.Node, p.TaskIDs
+	p.State = task.Completed
+	m.podMu.Unlock()
+
+	if state != task.Pending {
+		m.stopPodMembers(nodeName, ids)
+	}
+	logger.Info("停止 Pod", "pod_id", id)
+	return nil
+}
+
+func (m *Manager) stopPodMembers(nodeName string, ids []uuid.UUID) {
+	for i := len(ids) - 1; i >= 0; i-- {
+		id := ids[i]
+		result, err := m.TaskDb.Get(id.String())
+		if err != nil {
+			continue
+		}
+		t := result.(*task.Task)
+		if t.State == task.Scheduled || t.State == task.Running {
+			_ = m.stopTask(context.Background(), nodeName, id.String())
+		}
+	}
+}
+
+// podsIn 返回处于指定状态的 Pod, 调度和下发时不持有 podMu
+func (m *Manager) podsIn(states ...task.State) []*task.Pod {
+	m.podMu.Lock()
+	defer m.podMu.Unlock()
+
+	var pods []*task.Pod
+	for _, p := range m.pods {
+		if task.Contains(states, p.State) {
+			pods = append(pods, p)
+		}
+	}
+	return pods
+}
+
+func (m *Manager) processPods() {
+	for _, p := range m.podsIn(task.Pending) {
+		m.podMu.Lock()
+		rt := p.ResourceTask()
+		m.podMu.Unlock()
+
+		n, err := m.SelectWorker(rt)
+		if err != nil {
+			logger.Warn("Pod 无法调度", "pod_id", p.ID, "error", err)
+			continue
+		}
+		m.startPod(p, n)
+	}
+}
+
+// startPod 按顺序将本次启动的成员下发到同一节点, worker 按接收顺序启动成员,
+// 保证第一个成员先于共享其网络的其他成员运行。下发期间 Pod 被停止时停止已下发的成员
+func (m *Manager) startPod(p *task.Pod, n *node.Node) {
+	m.podMu.Lock()
+	members := p.NewMembers()
+	m.podMu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(members))
+	for _, t := range members {
+		te := task.Event{
+			ID:        uuid.New(),
+			State:     task.Running,
+			Timestamp: time.Now(),
+			Task:      t,
+		}
+		if err := m.dispatch(te, n); err != nil {
+			logger.Warn("Pod 成员下发失败, 停止已下发的成员, 等待重新调度", "pod_id", p.ID, "task_id", t.ID, "node", n.Name, "error", err)
+			m.stopPodMembers(n.Name, ids)
+			m.podMu.Lock()
+			if p.State != task.Completed {
+				p.State = task.Pending
+			}
+			m.podMu.Unlock()
+			return
+		}
+		ids = append(ids, t.ID)
+	}
+
+	m.podMu.Lock()
+	if p.State == task.Completed {
+		m.podMu.Unlock()
+		logger.Info("Pod 已停止, 停止刚下发的成员", "pod_id", p.ID)
+		m.stopPodMembers(n.Name, ids)
+		return
+	}
+	p.Node = n.Name
+	p.TaskIDs = ids
+	p.State = task.Scheduled
+	m.podMu.Unlock()
+	logger.Info("Pod 成员已下发", "pod_id", p.ID, "members", len(members), "node", n.Name)
+}
+
+// updatePods 根据成员状态汇总 Pod 状态, 任一成员失败时整体重启 Pod; 删除已结束 Pod 的存储卷
+func (m *Manager) updatePods() {
+	for _, p := range m.podsIn(task.Scheduled, task.Running) {
+		m.updatePod(p)
+	}
+	for _, p := range m.podsIn(task.Completed, task.Failed) {
+		m.removePodVolumes(p)
+	}
+}
+
+func (m *Manager) updatePod(p *task.Pod) {
+	m.podMu.Lock()
+	nodeName, ids := p.Node, p.TaskIDs
+	m.podMu.Unlock()
+
+	var members []task.Task
+	for _, id := range ids {
+		if result, err := m.TaskDb.Get(id.String()); err == nil {
+			members = append(members, *result.(*task.Task))
+		}
+	}
+	state := aggregateState(members)
+
+	m.podMu.Lock()
+	// 汇总期间 Pod 被停止
+	if p.State != task.Scheduled && p.State != task.Running {
+		m.podMu.Unlock()
+		return
+	}
+	if state != task.Failed {
+		p.State = state
+		m.podMu.Unlock()
+		return
+	}
+	restart := p.RestartCount < maxPodRestarts
+	if !restart {
+		p.State = task.Failed
+	}
+	m.podMu.Unlock()
+
+	m.stopPodMembers(nodeName, ids)
+	if !restart {
+		logger.Warn("Pod 重启次数已达上限, 标记为失败", "pod_id", p.ID, "max_restarts", maxPodRestarts)
+		return
+	}
+	n, err := m.GetNode(nodeName)
+
+	m.podMu.Lock()
+	if p.State != task.Scheduled && p.State != task.Running {
+		m.podMu.Unlock()
+		return
+	}
+	if err != nil {
+		p.State = task.Pending
+		m.podMu.Unlock()
+		logger.Warn("Pod 所在节点不存在, 重新调度", "pod_id", p.ID, "node", nodeName)
+		return
+	}
+	p.RestartCount++
+	restartCount := p.RestartCount
+	m.podMu.Unlock()
+
+	logger.Info("Pod 成员失败, 整体重启", "pod_id", p.ID, "node", n.Name, "restart_count", restartCount)
+	m.startPod(p, n)
+}
+
+// removePodVolumes 所有成员结束后请求 Pod 所在节点删除 Pod 的存储卷, 失败时下次重试
+func (m *Manager) removePodVolumes(p *task.Pod) {
+	m.podMu.Lock()
+	if p.VolumesRemoved || len(p.Volumes) == 0 || p.Node == "" {
+		m.podMu.Unlock()
+		return
+	}
+	nodeName, ids := p.Node, p.TaskIDs
+	volumes := make([]string, 0, len(p.Volumes))
+	for _, v := range p.Volumes {
+		volumes = append(volumes, p.VolumeName(v))
+	}
+	m.podMu.Unlock()
+
+	for _, id := range ids {
+		if result, err := m.TaskDb.Get(id.String()); err == nil {
+			if t := result.(*task.Task); t.State != task.Completed && t.State != task.Failed {
+				return
+			}
+		}
+	}
+	for _, v := range volumes {
+		if err := m.removeVolume(nodeName, v); err != nil {
+			logger.Warn("删除 Pod 存储卷失败", "pod_id", p.ID, "node", nodeName, "volume", v, "error", err)
+			return
+		}
+	}
+
+	m.podMu.Lock()
+	p.VolumesRemoved = true
+	m.podMu.Unlock()
+	logger.Info("删除 Pod 存储卷", "pod_id", p.ID, "node", nodeName, "volumes", volumes)
+}
+
+func (m *Manager) removeVolume(worker string, name string) (err error) {
+	ctx, span := tracer.Start(context.Background(), "manager.remove_volume", trace.WithAttributes(
+		attribute.String("node", worker),
+		attribute.String("volume", name),
+	))
+	defer func() {
+		tracing.RecordError(span, err)
+		span.End()
+	}()
+
+	url := fmt.Sprintf("http://%s/volumes/%s", worker, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := tracing.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("响应状态码 %d", resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,108 @@
+package manager
+
+import (
+	"context"
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"sort"
+)
+
+// preempt 为无法调度的任务选择一个节点, 驱逐该节点上优先级更低的任务并重新加入 Pending 队列。
+// 优先选择驱逐任务数最少的节点
+func (m *Manager) preempt(ctx context.Context, t task.Task) (*node.Node, error) {
+	m.syncNodeTasks()
+	nodes := m.nodes()
+
+	var bestNode *node.Node
+	var bestVictims []*task.Task
+	for _, n := range nodes {
+		victims, ok := m.selectVictims(t, n, nodes)
+		if !ok {
+			continue
+		}
+		if bestNode == nil || len(victims) < len(bestVictims) {
+			bestNode = n
+			bestVictims = victims
+		}
+	}
+	if bestNode == nil {
+		return nil, fmt.Errorf("驱逐低优先级任务后仍没有节点满足任务 %s", t.ID)
+	}
+
+	// 只重新调度已经停止的任务, 有任务停止失败时节点上的资源没有全部腾出, 放弃本次抢占
+	var stopErr error
+	for _, v := range bestVictims {
+		logger.Info("抢占: 驱逐低优先级任务腾出资源", "node", bestNode.Name, "victim_id", v.ID,
+			"victim_priority", v.Priority, "task_id", t.ID, "priority", t.Priority)
+		if err := m.stopTask(ctx, bestNode.Name, v.ID.String()); err != nil {
+			logger.Warn("抢占: 停止低优先级任务失败", "node", bestNode.Name, "victim_id", v.ID, "error", err)
+			stopErr = err
+			continue
+		}
+		// 重新读取 stopTask 更新后的任务记录
+		if result, err := m.TaskDb.Get(v.ID.String()); err == nil {
+			v = result.(*task.Task)
+		}
+		_ = m.transition(v, task.Stopping, "Preempted")
+		_ = m.transition(v, task.Completed, "Preempted")
+		_ = m.TaskDb.Put(v.ID.String(), v)
+		m.rescheduleTask(v)
+	}
+	m.syncNodeTasks()
+	if stopErr != nil {
+		return nil, fmt.Errorf("抢占节点 %s 失败: %v", bestNode.Name, stopErr)
+	}
+
+	return bestNode, nil
+}
+
+// selectVictims 按优先级从低到高依次移除节点上优先级低于 t 的任务, 直到 t 能通过调度过滤条件
+func (m *Manager) selectVictims(t task.Task, n *node.Node, nodes []*node.Node) ([]*task.Task, bool) {
+	var lower, remaining []*task.Task
+	for _, nt := range n.Tasks {
+		if nt.Priority < t.Priority {
+			lower = append(lower, nt)
+		} else {
+			remaining = append(remaining, nt)
+		}
+	}
+	sort.SliceStable(lower, func(i, j int) bool {
+		return lower[i].Priority < lower[j].Priority
+	})
+
+	var victims []*task.Task
+	for {
+		if m.fitsWithout(t, n, nodes, append(remaining, lower...)) {
+			return victims, len(victims) > 0
+		}
+		if len(lower) == 0 {
+			return nil, false
+		}
+		victims = append(victims, lower[0])
+		lower = lower[1:]
+	}
+}
+
+// fitsWithout 判断节点 n 上只保留 tasks 时任务 t 能否调度到该节点, nodes 为所有节点的快照
+func (m *Manager) fitsWithout(t task.Task, n *node.Node, nodes []*node.Node, tasks []*task.Task) bool {
+	candidate := *n
+	candidate.Tasks = tasks
+	candidate.UpdateAllocated()
+
+	trial := make([]*node.Node, 0, len(nodes))
+	for _, wn := range nodes {
+		if wn == n {
+			trial = append(trial, &candidate)
+		} else {
+			trial = append(trial, wn)
+		}
+	}
+
+	for _, c := range m.scheduler.SelectCandidateNodes(t, trial) {
+		if c == &candidate {
+			return true
+		}
+	}
+	return false
+}
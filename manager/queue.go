@@ -0,0 +1,89 @@
+package manager
+
+import (
+	"container/heap"
+	"cube/task"
+	"github.com/google/uuid"
+	"sync"
+)
+
+// PriorityQueue 按任务优先级出队的任务事件队列, 优先级相同时先进先出
+type PriorityQueue struct {
+	mu    sync.Mutex
+	items eventHeap
+	seq   uint64
+}
+
+func NewPriorityQueue() *PriorityQueue {
+	return &PriorityQueue{}
+}
+
+func (q *PriorityQueue) Enqueue(te task.Event) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.seq++
+	heap.Push(&q.items, queuedEvent{event: te, seq: q.seq})
+}
+
+func (q *PriorityQueue) Dequeue() (task.Event, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.items.Len() == 0 {
+		return task.Event{}, false
+	}
+	return heap.Pop(&q.items).(queuedEvent).event, true
+}
+
+// Remove 移除任务 id 的所有事件, 返回是否有事件被移除
+func (q *PriorityQueue) Remove(id uuid.UUID) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	items := q.items[:0]
+	for _, item := range q.items {
+		if item.event.Task.ID != id {
+			items = append(items, item)
+		}
+	}
+	removed := len(items) < len(q.items)
+	q.items = items
+	heap.Init(&q.items)
+	return removed
+}
+
+func (q *PriorityQueue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.items.Len()
+}
+
+type queuedEvent struct {
+	event task.Event
+	seq   uint64
+}
+
+type eventHeap []queuedEvent
+
+func (h eventHeap) Len() int { return len(h) }
+
+func (h eventHeap) Less(i, j int) bool {
+	if h[i].event.Task.Priority != h[j].event.Task.Priority {
+		return h[i].event.Task.Priority > h[j].event.Task.Priority
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h eventHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *eventHeap) Push(x any) { *h = append(*h, x.(queuedEvent)) }
+
+func (h *eventHeap) Pop() any {
+	old := *h
+	n := len(old)
+	item := old[n-1]
+	*h = old[:n-1]
+	return item
+}
@@ -0,0 +1,106 @@
+package manager
+
+import (
+	"cube/task"
+	"encoding/json"
+	"fmt"
+	"github.com/google/uuid"
+	"net/http"
+	"time"
+)
+
+const (
+	statsInterval = 5 * time.Second
+	// 超过该时间未成功采集统计信息的节点被标记为过期
+	statsTTL = 3 * statsInterval
+)
+
+// CollectStats 后台定期采集各节点统计信息, 调度时直接读取缓存, 不再访问节点。
+// 第一轮采集完成后才开始调度
+func (m *Manager) CollectStats() {
+	for {
+		m.collectStats()
+		m.statsReadyOnce.Do(func() { close(m.statsReady) })
+		time.Sleep(statsInterval)
+	}
+}
+
+// collectStats 访问节点时不持有 nodeMu, 取得统计信息后再更新节点
+func (m *Manager) collectStats() {
+	for _, s := range m.nodes() {
+		stats, err := s.GetStats()
+		if err != nil {
+			logger.Warn("采集节点统计信息失败", "node", s.Name, "error", err)
+		}
+
+		m.nodeMu.Lock()
+		n, _ := m.workerNode(s.Name)
+		if stats != nil {
+			n.UpdateStats(*stats)
+		}
+		stale := n.StatsTime.IsZero() || time.Since(n.StatsTime) > statsTTL
+		if stale != n.Stale {
+			logger.Info("节点统计信息过期状态变化", "node", n.Name, "stale", stale)
+		}
+		becameReady := n.Stale && !stale
+		becameStale := !n.Stale && stale
+		n.Stale = stale
+		snapshot := n.Snapshot()
+		m.nodeMu.Unlock()
+
+		if becameStale {
+			m.recordNodeEvent(EventNodeNotReady, n.Name, fmt.Sprintf("节点 %s 统计信息超过 %v 未更新", n.Name, statsTTL))
+			m.markNodeTasksLost(n.Name)
+		}
+		if becameReady {
+			m.recordNodeEvent(EventNodeReady, n.Name, fmt.Sprintf("节点 %s 就绪", n.Name))
+			m.retryBacklog(fmt.Sprintf("节点 %s 就绪", n.Name))
+		}
+		m.publishNode(snapshot)
+	}
+}
+
+// TaskUsage 任务最近一次的资源使用量
+type TaskUsage struct {
+	TaskID uuid.UUID
+	Name   string
+	Node   string
+	Usage  task.Usage
+}
+
+// GetTaskUsage 返回各节点上报的运行中任务最近一次的资源使用量
+func (m *Manager) GetTaskUsage() []TaskUsage {
+	usage := m.taskUsage()
+	var result []TaskUsage
+	for _, t := range m.GetTasks() {
+		u, ok := usage[t.ID.String()]
+		if !ok {
+			continue
+		}
+		result = append(result, TaskUsage{TaskID: t.ID, Name: t.Name, Node: t.Node, Usage: u})
+	}
+	return result
+}
+
+// GetTaskUsageHistory 从任务所在 worker 获取任务最近的资源使用量采样
+func (m *Manager) GetTaskUsageHistory(id uuid.UUID) ([]task.Usage, error) {
+	w, ok := m.taskWorker(id)
+	if !ok {
+		return nil, fmt.Errorf("任务 %s 未下发到 worker", id)
+	}
+	url := fmt.Sprintf("http://%s/tasks/%s/stats", w, id)
+	resp, err := http.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("worker %s 响应状态码 %d", w, resp.StatusCode)
+	}
+
+	var history []task.Usage
+	if err := json.NewDecoder(resp.Body).Decode(&history); err != nil {
+		return nil, err
+	}
+	return history, nil
+}
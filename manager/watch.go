@@ -0,0 +1,217 @@
+package manager
+
+import (
+	"bytes"
+	"cube/node"
+	"cube/store"
+	"cube/worker"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// watch 事件类型
+const (
+	WatchAdded    = "ADDED"
+	WatchModified = "MODIFIED"
+	WatchDeleted  = "DELETED"
+	// 无法从请求的版本继续读取时发送, 客户端需要重新读取完整列表
+	WatchError = "ERROR"
+)
+
+// 保留的历史变化数, 断开后请求的版本早于保留范围时需要重新读取完整列表
+const watchHistorySize = 1000
+
+// WatchEvent 一次对象变化, ResourceVersion 在同一类对象内单调递增
+type WatchEvent struct {
+	Type            string
+	ResourceVersion uint64
+	Object          json.RawMessage
+}
+
+// watchHub 记录一类对象 (任务或者节点) 的变化, 对象内容与上次相同时不产生变化
+type watchHub struct {
+	mu       sync.Mutex
+	version  uint64
+	objects  map[string]json.RawMessage
+	history  []WatchEvent
+	watchers map[chan WatchEvent]struct{}
+}
+
+func newWatchHub() *watchHub {
+	return &watchHub{
+		objects:  make(map[string]json.RawMessage),
+		watchers: make(map[chan WatchEvent]struct{}),
+	}
+}
+
+// load 记录已有对象作为初始状态, 不产生变化
+func (h *watchHub) load(key string, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.objects[key] = data
+}
+
+func (h *watchHub) update(key string, obj any) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		logger.Error("json 编码错误", "key", key, "error", err)
+		return
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	prev, ok := h.objects[key]
+	if ok && bytes.Equal(prev, data) {
+		return
+	}
+	h.objects[key] = data
+	typ := WatchModified
+	if !ok {
+		typ = WatchAdded
+	}
+	h.publish(typ, data)
+}
+
+func (h *watchHub) remove(key string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	data, ok := h.objects[key]
+	if !ok {
+		return
+	}
+	delete(h.objects, key)
+	h.publish(WatchDeleted, data)
+}
+
+func (h *watchHub) publish(typ string, data json.RawMessage) {
+	h.version++
+	e := WatchEvent{Type: typ, ResourceVersion: h.version, Object: data}
+	h.history = append(h.history, e)
+	if n := len(h.history); n > watchHistorySize {
+		h.history = h.history[n-watchHistorySize:]
+	}
+
+	for ch := range h.watchers {
+		select {
+		case ch <- e:
+		default:
+			delete(h.watchers, ch)
+			close(ch)
+		}
+	}
+}
+
+func (h *watchHub) resourceVersion() uint64 {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.version
+}
+
+// watch 未指定版本 (from 为 nil) 时以 ADDED 事件返回所有现有对象, 否则返回该版本之后的变化,
+// 版本早于保留的历史时返回错误。之后的变化通过 channel 发送, 连接结束时调用返回的函数取消 watch
+func (h *watchHub) watch(from *uint64) ([]WatchEvent, <-chan WatchEvent, func(), error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var initial []WatchEvent
+	if from == nil {
+		keys := make([]string, 0, len(h.objects))
+		for k := range h.objects {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			initial = append(initial, WatchEvent{Type: WatchAdded, ResourceVersion: h.version, Object: h.objects[k]})
+		}
+	} else {
+		if *from > h.version {
+			return nil, nil, nil, fmt.Errorf("版本 %d 大于当前版本 %d", *from, h.version)
+		}
+		if *from < h.version && (len(h.history) == 0 || h.history[0].ResourceVersion > *from+1) {
+			return nil, nil, nil, fmt.Errorf("版本 %d 已过期, 请重新读取完整列表", *from)
+		}
+		for _, e := range h.history {
+			if e.ResourceVersion > *from {
+				initial = append(initial, e)
+			}
+		}
+	}
+
+	ch := make(chan WatchEvent, watchBufferSize)
+	h.watchers[ch] = struct{}{}
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := h.watchers[ch]; ok {
+			delete(h.watchers, ch)
+			close(ch)
+		}
+	}
+	return initial, ch, cancel, nil
+}
+
+func (m *Manager) WatchTasks(from *uint64) ([]WatchEvent, <-chan WatchEvent, func(), error) {
+	return m.taskWatch.watch(from)
+}
+
+func (m *Manager) WatchNodes(from *uint64) ([]WatchEvent, <-chan WatchEvent, func(), error) {
+	return m.nodeWatch.watch(from)
+}
+
+// publishNode 节点统计信息, 调度状态或者污点变化后调用
+func (m *Manager) publishNode(n *node.Node) {
+	m.nodeWatch.update(n.Name, watchedNode(n))
+}
+
+// watchedNode 返回 watch 输出的节点副本, 去掉每次采集都会变化的统计信息 (Stats, StatsTime 和 CpuUsage),
+// 只有就绪状态, 调度状态, 标签, 污点, 容量和已分配资源变化时才产生 MODIFIED 事件
+func watchedNode(n *node.Node) *node.Node {
+	c := *n
+	c.Stats = worker.Stats{}
+	c.StatsTime = time.Time{}
+	c.CpuUsage = 0
+	return &c
+}
+
+// watchedStore 在写入和删除任务时记录变化, 写入和记录在同一把锁内完成, 变化的顺序与写入顺序一致
+type watchedStore struct {
+	store.Store
+	hub *watchHub
+	mu  sync.Mutex
+}
+
+func (s *watchedStore) Put(key string, value any) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.Put(key, value); err != nil {
+		return err
+	}
+	s.hub.update(key, value)
+	return nil
+}
+
+func (s *watchedStore) Query(q store.TaskQuery) (store.TaskPage, error) {
+	qs, ok := s.Store.(store.TaskQuerier)
+	if !ok {
+		return store.TaskPage{}, errors.New("任务存储不支持查询")
+	}
+	return qs.Query(q)
+}
+
+func (s *watchedStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.Store.Delete(key); err != nil {
+		return err
+	}
+	s.hub.remove(key)
+	return nil
+}
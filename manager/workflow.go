@@ -0,0 +1,179 @@
+package manager
+
+import (
+	"cube/task"
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+func (m *Manager) AddWorkflow(wf task.Workflow) (task.Workflow, error) {
+	if wf.ID == uuid.Nil {
+		wf.ID = uuid.New()
+	}
+	wf.State = task.Pending
+	for i := range wf.Steps {
+		wf.Steps[i].State = task.Pending
+		wf.Steps[i].Reason = ""
+		wf.Steps[i].TaskIDs = nil
+	}
+
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+	if err := m.WorkflowDb.Put(wf.ID.String(), &wf); err != nil {
+		return wf, err
+	}
+	return copyWorkflow(&wf), nil
+}
+
+func (m *Manager) GetWorkflows() []task.Workflow {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+
+	result, err := m.WorkflowDb.List()
+	if err != nil {
+		logger.Error("获取工作流列表失败", "error", err)
+		return nil
+	}
+	workflows := make([]task.Workflow, 0)
+	for _, wf := range result.([]*task.Workflow) {
+		workflows = append(workflows, copyWorkflow(wf))
+	}
+	return workflows
+}
+
+func (m *Manager) GetWorkflow(id uuid.UUID) (task.Workflow, error) {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+
+	result, err := m.WorkflowDb.Get(id.String())
+	if err != nil {
+		return task.Workflow{}, err
+	}
+	return copyWorkflow(result.(*task.Workflow)), nil
+}
+
+func copyWorkflow(wf *task.Workflow) task.Workflow {
+	c := *wf
+	c.Steps = make([]task.WorkflowStep, len(wf.Steps))
+	for i, s := range wf.Steps {
+		c.Steps[i] = s
+		c.Steps[i].TaskIDs = append([]uuid.UUID(nil), s.TaskIDs...)
+	}
+	return c
+}
+
+func (m *Manager) processWorkflows() {
+	m.workflowMu.Lock()
+	defer m.workflowMu.Unlock()
+
+	result, err := m.WorkflowDb.List()
+	if err != nil {
+		logger.Error("获取工作流列表失败", "error", err)
+		return
+	}
+	for _, wf := range result.([]*task.Workflow) {
+		if wf.State == task.Completed || wf.State == task.Failed {
+			continue
+		}
+		m.advanceWorkflow(wf)
+		_ = m.WorkflowDb.Put(wf.ID.String(), wf)
+	}
+}
+
+// advanceWorkflow 同步各步骤当前任务的状态, 重试失败的步骤, 启动上游步骤全部完成的步骤,
+// 上游步骤最终失败时下游步骤不再运行并标记为失败
+func (m *Manager) advanceWorkflow(wf *task.Workflow) {
+	for i := range wf.Steps {
+		s := &wf.Steps[i]
+		if len(s.TaskIDs) == 0 || s.Finished() {
+			continue
+		}
+		result, err := m.TaskDb.Get(s.TaskIDs[len(s.TaskIDs)-1].String())
+		if err != nil {
+			// 任务尚未下发
+			continue
+		}
+		t := result.(*task.Task)
+		s.State = t.State
+		s.Reason = t.Reason
+		if t.State == task.Failed && !s.Finished() {
+			logger.Info("工作流步骤失败, 重试", "workflow_id", wf.ID, "step", s.Name, "task_id", t.ID, "attempt", len(s.TaskIDs))
+			m.submitStep(wf, s)
+		}
+	}
+
+	for i := range wf.Steps {
+		s := &wf.Steps[i]
+		if s.State != task.Pending || len(s.TaskIDs) > 0 {
+			continue
+		}
+		ready := true
+		for _, dep := range s.DependsOn {
+			upstream := wf.Step(dep)
+			if upstream.State == task.Failed && upstream.Finished() {
+				s.State = task.Failed
+				s.Reason = fmt.Sprintf("%s: %s", task.ReasonUpstreamFailed, dep)
+				logger.Info("工作流步骤的上游步骤失败, 不再运行", "workflow_id", wf.ID, "step", s.Name, "upstream", dep)
+				ready = false
+				break
+			}
+			if upstream.State != task.Completed {
+				ready = false
+			}
+		}
+		if ready {
+			m.submitStep(wf, s)
+		}
+	}
+
+	state := workflowState(wf)
+	if state != wf.State {
+		logger.Info("工作流状态变化", "workflow_id", wf.ID, "state", state)
+		wf.State = state
+	}
+}
+
+// submitStep 以新的任务运行步骤, 容器名称带上运行次数以免与上次运行保留的容器冲突
+func (m *Manager) submitStep(wf *task.Workflow, s *task.WorkflowStep) {
+	t := s.Task
+	t.ID = uuid.New()
+	t.Name = fmt.Sprintf("%s-%s-%d", wf.Name, s.Name, len(s.TaskIDs))
+	t.State = task.Pending
+	t.Transitions = nil
+	t.WorkflowID = wf.ID
+
+	m.AddTask(task.Event{
+		ID:        uuid.New(),
+		State:     task.Running,
+		Timestamp: time.Now(),
+		Task:      t,
+	})
+	s.TaskIDs = append(s.TaskIDs, t.ID)
+	s.State = task.Pending
+	logger.Info("工作流步骤加入 Pending 队列", "workflow_id", wf.ID, "step", s.Name, "task_id", t.ID)
+}
+
+func workflowState(wf *task.Workflow) task.State {
+	finished, failed, started := true, false, false
+	for i := range wf.Steps {
+		s := &wf.Steps[i]
+		if len(s.TaskIDs) > 0 {
+			started = true
+		}
+		if !s.Finished() {
+			finished = false
+		} else if s.State == task.Failed {
+			failed = true
+		}
+	}
+	switch {
+	case finished && failed:
+		return task.Failed
+	case finished:
+		return task.Completed
+	case started:
+		return task.Running
+	}
+	return task.Pending
+}
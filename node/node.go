@@ -1,21 +1,26 @@
 package node
 
 import (
-	"cube/utils"
+	"cube/logging"
+	"cube/task"
 	"cube/worker"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/c9s/goprocinfo/linux"
 	"io/ioutil"
-	"log"
 	"net/http"
+	"time"
 )
 
+var logger = logging.Component("node")
+
 type Node struct {
 	Name            string
 	IP              string
 	Api             string
 	Cores           int64
+	CpuAllocated    float64
 	Memory          int64
 	MemoryAllocated int64
 	Disk            int64
@@ -23,32 +28,69 @@ type Node struct {
 	Stats           worker.Stats
 	Role            string
 	TaskCount       int
+	Labels          map[string]string
+	Taints          []Taint
+	// 节点是否被禁止调度
+	Unschedulable bool
+	// 最近一次采集统计信息的时间, 以及由相邻两次采样计算的 CPU 使用率
+	StatsTime time.Time
+	CpuUsage  float64
+	// 统计信息过期的节点不参与调度
+	Stale bool
+	// 节点上未结束的任务, 由 manager 在调度前同步
+	Tasks []*task.Task `json:"-"`
+}
+
+// UpdateAllocated 根据节点上未结束任务的资源请求重新计算已分配资源, 内存单位为 KB, 磁盘单位为字节
+func (n *Node) UpdateAllocated() {
+	n.CpuAllocated = 0
+	n.MemoryAllocated = 0
+	n.DiskAllocated = 0
+	for _, t := range n.Tasks {
+		n.CpuAllocated += t.Cpu
+		n.MemoryAllocated += t.Memory / 1000
+		n.DiskAllocated += t.Disk
+	}
+	n.TaskCount = len(n.Tasks)
+}
+
+// Snapshot 返回节点的副本, 调度器和 HTTP 接口读取副本, 修改副本的任务列表和污点不影响节点
+func (n *Node) Snapshot() *Node {
+	c := *n
+	c.Tasks = append([]*task.Task(nil), n.Tasks...)
+	c.Taints = append([]Taint(nil), n.Taints...)
+	return &c
 }
 
 func NewNode(name string, api string, role string) *Node {
 	return &Node{
-		Name: name,
-		Api:  api,
-		Role: role,
+		Name:  name,
+		Api:   api,
+		Role:  role,
+		Stale: true,
 	}
 }
 
+// statsClient 采集统计信息时不重试, 节点不可达时尽快返回, 由 manager 标记过期
+var statsClient = &http.Client{Timeout: 3 * time.Second}
+
+// GetStats 从节点获取统计信息, 不修改节点, 由调用方通过 UpdateStats 更新
 func (n *Node) GetStats() (*worker.Stats, error) {
 	var resp *http.Response
 	var err error
 
 	url := fmt.Sprintf("%s/stats", n.Api)
-	resp, err = utils.HttpWithRetry(http.Get, url)
+	resp, err = statsClient.Get(url)
 	if err != nil {
 		msg := fmt.Sprintf("连接失败: %v\n", n.Api)
-		log.Println(msg)
+		logger.Warn("连接节点失败", "node", n.Name, "error", err)
 		return nil, errors.New(msg)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
 		msg := fmt.Sprintf("响应错误, stats: %v, %v\n", n.Api, err)
-		log.Println(msg)
+		logger.Warn("获取节点统计信息响应错误", "node", n.Name, "status", resp.StatusCode)
 		return nil, errors.New(msg)
 	}
 
@@ -57,14 +99,46 @@ func (n *Node) GetStats() (*worker.Stats, error) {
 	err = json.Unmarshal(body, &stats)
 	if err != nil {
 		msg := fmt.Sprintf("json 解码错误, 节点: %v\n", n.Name)
-		log.Println(msg)
+		logger.Warn("json 解码错误", "node", n.Name, "error", err)
 		return nil, errors.New(msg)
 	}
+	return &stats, nil
+}
 
+// UpdateStats 根据采集的统计信息更新节点容量, 标签以及 CPU 使用率。worker 尚未重新采集 (采集时间不变) 时不更新,
+// StatsTime 为收到新采样的时间, worker 停止采集后节点统计信息会过期
+func (n *Node) UpdateStats(stats worker.Stats) {
+	if !n.StatsTime.IsZero() && stats.CollectedAt.Equal(n.Stats.CollectedAt) {
+		return
+	}
 	n.Memory = int64(stats.MemTotalKb())
 	n.Disk = int64(stats.DiskTotal())
+	n.Cores = int64(stats.CpuCount)
+	n.Labels = stats.Labels
 
+	if n.Stats.CpuStats != nil && stats.CpuStats != nil {
+		n.CpuUsage = cpuUsage(n.Stats.CpuStats, stats.CpuStats)
+	}
 	n.Stats = stats
+	n.StatsTime = time.Now()
+}
+
+// https://stackoverflow.com/a/23376195
+func cpuUsage(stat1 *linux.CPUStat, stat2 *linux.CPUStat) float64 {
+	stat1Idle := stat1.Idle + stat1.IOWait
+	stat2Idle := stat2.Idle + stat2.IOWait
 
-	return &n.Stats, nil
+	stat1NonIdle := stat1.User + stat1.Nice + stat1.System + stat1.IRQ + stat1.SoftIRQ + stat1.Steal
+	stat2NonIdle := stat2.User + stat2.Nice + stat2.System + stat2.IRQ + stat2.SoftIRQ + stat2.Steal
+
+	stat1Total := stat1Idle + stat1NonIdle
+	stat2Total := stat2Idle + stat2NonIdle
+
+	total := stat2Total - stat1Total
+	idle := stat2Idle - stat1Idle
+
+	if total == 0 {
+		return 0.00
+	}
+	return (float64(total) - float64(idle)) / float64(total)
 }
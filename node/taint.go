@@ -0,0 +1,50 @@
+package node
+
+import (
+	"cube/task"
+	"fmt"
+	"strings"
+)
+
+const (
+	// NoSchedule 不容忍该污点的任务不会被调度到节点
+	NoSchedule = "NoSchedule"
+	// PreferNoSchedule 尽量避免将不容忍该污点的任务调度到节点
+	PreferNoSchedule = "PreferNoSchedule"
+)
+
+type Taint struct {
+	Key    string
+	Value  string
+	Effect string
+}
+
+func (t Taint) String() string {
+	if t.Value == "" {
+		return fmt.Sprintf("%s:%s", t.Key, t.Effect)
+	}
+	return fmt.Sprintf("%s=%s:%s", t.Key, t.Value, t.Effect)
+}
+
+func (t Taint) ToleratedBy(tolerations []task.Toleration) bool {
+	for _, tl := range tolerations {
+		if tl.Tolerates(t.Key, t.Value, t.Effect) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseTaint 解析 key=value:Effect 或 key:Effect 格式的污点
+func ParseTaint(s string) (Taint, error) {
+	kv, effect, ok := strings.Cut(s, ":")
+	if !ok || kv == "" {
+		return Taint{}, fmt.Errorf("污点格式错误: %s, 应为 key=value:Effect", s)
+	}
+	if effect != NoSchedule && effect != PreferNoSchedule {
+		return Taint{}, fmt.Errorf("不支持的污点效果: %s", effect)
+	}
+	key, value, _ := strings.Cut(kv, "=")
+
+	return Taint{Key: key, Value: value, Effect: effect}, nil
+}
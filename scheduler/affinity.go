@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+	"math"
+)
+
+// topologyValue 返回节点在拓扑键 key 下所属的拓扑域, key 为空时拓扑域为节点本身
+func topologyValue(n *node.Node, key string) (string, bool) {
+	if key == "" {
+		return n.Name, true
+	}
+	v, ok := n.Labels[key]
+	return v, ok
+}
+
+func countMatching(n *node.Node, selector map[string]string) int {
+	count := 0
+	for _, t := range n.Tasks {
+		if task.MatchLabels(selector, t.Labels) {
+			count++
+		}
+	}
+	return count
+}
+
+// domainCounts 统计每个拓扑域中标签匹配 selector 的任务数
+func domainCounts(key string, selector map[string]string, nodes []*node.Node) map[string]int {
+	counts := make(map[string]int)
+	for _, n := range nodes {
+		v, ok := topologyValue(n, key)
+		if !ok {
+			continue
+		}
+		counts[v] += countMatching(n, selector)
+	}
+	return counts
+}
+
+func checkAntiAffinity(t task.Task, n *node.Node, nodes []*node.Node) error {
+	for _, term := range t.AntiAffinity {
+		v, ok := topologyValue(n, term.TopologyKey)
+		if !ok {
+			continue
+		}
+		if domainCounts(term.TopologyKey, term.Labels, nodes)[v] > 0 {
+			return fmt.Errorf("违反反亲和性: 拓扑域 %s 已存在标签匹配 %v 的任务", v, term.Labels)
+		}
+	}
+	return nil
+}
+
+func checkTopologySpread(t task.Task, n *node.Node, nodes []*node.Node) error {
+	for _, c := range t.TopologySpread {
+		if c.WhenUnsatisfiable == task.ScheduleAnyway {
+			continue
+		}
+		v, ok := topologyValue(n, c.TopologyKey)
+		if !ok {
+			return fmt.Errorf("节点缺少拓扑标签 %s", c.TopologyKey)
+		}
+
+		counts := domainCounts(c.TopologyKey, c.Labels, nodes)
+		self := 0
+		if task.MatchLabels(c.Labels, t.Labels) {
+			self = 1
+		}
+		if skew := counts[v] + self - minCount(counts); skew > maxSkew(c) {
+			return fmt.Errorf("违反拓扑分布: 拓扑域 %s 偏差 %d 超过 %d", v, skew, maxSkew(c))
+		}
+	}
+	return nil
+}
+
+// spreadScore 返回节点在拓扑分布约束下的惩罚分, 所在拓扑域的匹配任务越多分数越高
+func spreadScore(t task.Task, n *node.Node, nodes []*node.Node) float64 {
+	score := 0.0
+	for _, c := range t.TopologySpread {
+		v, ok := topologyValue(n, c.TopologyKey)
+		if !ok {
+			continue
+		}
+		counts := domainCounts(c.TopologyKey, c.Labels, nodes)
+		total := 0
+		for _, count := range counts {
+			total += count
+		}
+		score += float64(counts[v]-minCount(counts)) / math.Max(1, float64(total))
+	}
+	return score
+}
+
+func minCount(counts map[string]int) int {
+	first := true
+	m := 0
+	for _, c := range counts {
+		if first || c < m {
+			m = c
+			first = false
+		}
+	}
+	return m
+}
+
+func maxSkew(c task.TopologySpreadConstraint) int {
+	if c.MaxSkew <= 0 {
+		return 1
+	}
+	return c.MaxSkew
+}
@@ -0,0 +1,72 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+// BinPacking 最佳适应装箱算法, 优先选择放入任务后剩余资源最少的节点,
+// 使任务集中在少数节点上, 便于空闲节点下线
+type BinPacking struct {
+	Name string
+}
+
+var binPackingPredicates = []predicate{checkCpuAvailable, checkMemoryAvailable, checkDiskAvailable}
+
+func (b *BinPacking) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return filterNodes(t, nodes, binPackingPredicates...)
+}
+
+func (b *BinPacking) FilterReasons(t task.Task, nodes []*node.Node) map[string]string {
+	return filterReasons(t, nodes, binPackingPredicates...)
+}
+
+func (b *BinPacking) Score(t task.Task, nodes []*node.Node) map[string]float64 {
+	return sumScores(b.ScoreBreakdown(t, nodes))
+}
+
+func (b *BinPacking) ScoreBreakdown(t task.Task, nodes []*node.Node) map[string]map[string]float64 {
+	breakdown := make(map[string]map[string]float64)
+	for _, n := range nodes {
+		scores := map[string]float64{"remaining": remainingRatio(t, n)}
+		breakdown[n.Name] = addConstraintScores(scores, t, n, nodes)
+	}
+
+	return breakdown
+}
+
+// remainingRatio 返回放入任务后节点 CPU, 内存, 磁盘剩余比例的平均值
+func remainingRatio(t task.Task, n *node.Node) float64 {
+	var ratios []float64
+	if n.Cores > 0 {
+		ratios = append(ratios, (float64(n.Cores)-n.CpuAllocated-t.Cpu)/float64(n.Cores))
+	}
+	if n.Memory > 0 {
+		ratios = append(ratios, float64(n.Memory-n.MemoryAllocated-t.Memory/1000)/float64(n.Memory))
+	}
+	if n.Disk > 0 {
+		ratios = append(ratios, float64(n.Disk-n.DiskAllocated-t.Disk)/float64(n.Disk))
+	}
+	if len(ratios) == 0 {
+		return 1.0
+	}
+
+	sum := 0.0
+	for _, r := range ratios {
+		sum += r
+	}
+	return sum / float64(len(ratios))
+}
+
+func (b *BinPacking) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
+	var bestNode *node.Node
+	var lowestScore float64
+	for idx, n := range candidates {
+		if idx == 0 || scores[n.Name] < lowestScore {
+			bestNode = n
+			lowestScore = scores[n.Name]
+		}
+	}
+
+	return bestNode
+}
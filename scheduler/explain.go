@@ -0,0 +1,48 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+)
+
+type NodeExplanation struct {
+	Name string
+	// 是否通过过滤条件, 未通过时 Reason 为原因
+	Passed bool
+	Reason string
+	// 各评分项分数及总分, 分数越低越优先
+	Scores map[string]float64
+	Total  float64
+}
+
+type Explanation struct {
+	Nodes []NodeExplanation
+	Pick  string
+}
+
+// Explain 对任务执行一次调度的过滤, 算分和选择过程, 不改变调度器状态也不下发任务
+func Explain(s Scheduler, t task.Task, nodes []*node.Node) Explanation {
+	reasons := s.FilterReasons(t, nodes)
+	candidates := s.SelectCandidateNodes(t, nodes)
+	breakdown := s.ScoreBreakdown(t, candidates)
+	scores := sumScores(breakdown)
+
+	var e Explanation
+	for _, n := range nodes {
+		reason, failed := reasons[n.Name]
+		e.Nodes = append(e.Nodes, NodeExplanation{
+			Name:   n.Name,
+			Passed: !failed,
+			Reason: reason,
+			Scores: breakdown[n.Name],
+			Total:  scores[n.Name],
+		})
+	}
+	if len(candidates) > 0 {
+		if picked := s.Pick(scores, candidates); picked != nil {
+			e.Pick = picked.Name
+		}
+	}
+
+	return e
+}
@@ -0,0 +1,35 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"fmt"
+)
+
+func checkDiskAvailable(t task.Task, n *node.Node, nodes []*node.Node) error {
+	if !checkDisk(t, n.Disk-n.DiskAllocated) {
+		return fmt.Errorf("磁盘不足: 需要 %d, 可用 %d", t.Disk, n.Disk-n.DiskAllocated)
+	}
+	return nil
+}
+
+func checkDisk(t task.Task, diskAvailable int64) bool {
+	return t.Disk <= diskAvailable
+}
+
+// checkMemoryAvailable 任务内存单位为字节, 节点内存单位为 KB
+func checkMemoryAvailable(t task.Task, n *node.Node, nodes []*node.Node) error {
+	available := n.Memory - n.MemoryAllocated
+	if t.Memory/1000 > available {
+		return fmt.Errorf("内存不足: 需要 %d KB, 可用 %d KB", t.Memory/1000, available)
+	}
+	return nil
+}
+
+func checkCpuAvailable(t task.Task, n *node.Node, nodes []*node.Node) error {
+	available := float64(n.Cores) - n.CpuAllocated
+	if t.Cpu > available {
+		return fmt.Errorf("CPU 不足: 需要 %.2f 核, 可用 %.2f 核", t.Cpu, available)
+	}
+	return nil
+}
@@ -1,48 +1,127 @@
 package scheduler
 
 import (
+	"cube/logging"
 	"cube/node"
 	"cube/task"
-	"log"
 	"math"
-	"time"
 )
 
+var logger = logging.Component("scheduler")
+
 type Scheduler interface {
 	SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node
+	// FilterReasons 返回未通过过滤条件的节点名称及原因
+	FilterReasons(t task.Task, nodes []*node.Node) map[string]string
 	Score(t task.Task, nodes []*node.Node) map[string]float64
+	// ScoreBreakdown 返回每个节点各评分项的分数, 各项之和即 Score 的结果, 不改变调度器状态
+	ScoreBreakdown(t task.Task, nodes []*node.Node) map[string]map[string]float64
 	Pick(scores map[string]float64, candidates []*node.Node) *node.Node
 }
 
+type predicate func(t task.Task, n *node.Node, nodes []*node.Node) error
+
+// 所有调度算法共用的过滤条件
+var defaultPredicates = []predicate{checkStatsFresh, checkSchedulable, checkTaints, checkAntiAffinity, checkTopologySpread}
+
+// filterNodes 依次执行通用过滤条件和调度算法特有的过滤条件, 返回全部通过的节点
+func filterNodes(t task.Task, nodes []*node.Node, predicates ...predicate) []*node.Node {
+	var candidates []*node.Node
+	for _, n := range nodes {
+		if err := checkNode(t, n, nodes, predicates...); err != nil {
+			logger.Debug("节点未通过过滤条件", "task_id", t.ID, "node", n.Name, "reason", err)
+			continue
+		}
+		candidates = append(candidates, n)
+	}
+
+	return candidates
+}
+
+func filterReasons(t task.Task, nodes []*node.Node, predicates ...predicate) map[string]string {
+	reasons := make(map[string]string)
+	for _, n := range nodes {
+		if err := checkNode(t, n, nodes, predicates...); err != nil {
+			reasons[n.Name] = err.Error()
+		}
+	}
+
+	return reasons
+}
+
+func checkNode(t task.Task, n *node.Node, nodes []*node.Node, predicates ...predicate) error {
+	for _, p := range append(defaultPredicates, predicates...) {
+		if err := p(t, n, nodes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addConstraintScores 将调度约束带来的惩罚分叠加到各调度算法的评分项中
+func addConstraintScores(scores map[string]float64, t task.Task, n *node.Node, nodes []*node.Node) map[string]float64 {
+	scores["topology_spread"] = spreadScore(t, n, nodes)
+	scores["taint"] = taintScore(t, n)
+	return scores
+}
+
+func sumScores(breakdown map[string]map[string]float64) map[string]float64 {
+	nodeScores := make(map[string]float64)
+	for name, scores := range breakdown {
+		total := 0.0
+		for _, score := range scores {
+			total += score
+		}
+		nodeScores[name] = total
+	}
+
+	return nodeScores
+}
+
 type RoundRobin struct {
 	Name       string
 	LastWorker int
 }
 
 func (r *RoundRobin) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	return nodes
+	return filterNodes(t, nodes)
+}
+
+func (r *RoundRobin) FilterReasons(t task.Task, nodes []*node.Node) map[string]string {
+	return filterReasons(t, nodes)
 }
 
 func (r *RoundRobin) Score(t task.Task, nodes []*node.Node) map[string]float64 {
-	nodeScores := make(map[string]float64)
-	var newWorker int
+	newWorker := r.nextWorker(nodes)
+	r.LastWorker = newWorker
+
+	return sumScores(r.scoreBreakdown(t, nodes, newWorker))
+}
+
+func (r *RoundRobin) ScoreBreakdown(t task.Task, nodes []*node.Node) map[string]map[string]float64 {
+	return r.scoreBreakdown(t, nodes, r.nextWorker(nodes))
+}
+
+func (r *RoundRobin) nextWorker(nodes []*node.Node) int {
 	if r.LastWorker < len(nodes) {
-		newWorker = r.LastWorker + 1
-		r.LastWorker++
-	} else {
-		newWorker = 0
-		r.LastWorker = 0
+		return r.LastWorker + 1
 	}
+	return 0
+}
 
+func (r *RoundRobin) scoreBreakdown(t task.Task, nodes []*node.Node, newWorker int) map[string]map[string]float64 {
+	breakdown := make(map[string]map[string]float64)
 	for idx, n := range nodes {
+		scores := make(map[string]float64)
 		if idx == newWorker {
-			nodeScores[n.Name] = 0.1
+			scores["round_robin"] = 0.1
 		} else {
-			nodeScores[n.Name] = 1.0
+			scores["round_robin"] = 1.0
 		}
+		breakdown[n.Name] = addConstraintScores(scores, t, n, nodes)
 	}
 
-	return nodeScores
+	return breakdown
 }
 
 func (r *RoundRobin) Pick(scores map[string]float64, candidates []*node.Node) *node.Node {
@@ -68,19 +147,14 @@ type EPvm struct {
 	Name string
 }
 
-func (E *EPvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
-	var candidates []*node.Node
-	for n := range nodes {
-		if checkDisk(t, nodes[n].Disk-nodes[n].DiskAllocated) {
-			candidates = append(candidates, nodes[n])
-		}
-	}
+var ePvmPredicates = []predicate{checkDiskAvailable, checkMemoryAvailable}
 
-	return candidates
+func (E *EPvm) SelectCandidateNodes(t task.Task, nodes []*node.Node) []*node.Node {
+	return filterNodes(t, nodes, ePvmPredicates...)
 }
 
-func checkDisk(t task.Task, diskAvailable int64) bool {
-	return t.Disk <= diskAvailable
+func (E *EPvm) FilterReasons(t task.Task, nodes []*node.Node) map[string]string {
+	return filterReasons(t, nodes, ePvmPredicates...)
 }
 
 const (
@@ -89,17 +163,17 @@ const (
 )
 
 func (E *EPvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
-	nodeScores := make(map[string]float64)
+	return sumScores(E.ScoreBreakdown(t, nodes))
+}
+
+func (E *EPvm) ScoreBreakdown(t task.Task, nodes []*node.Node) map[string]map[string]float64 {
+	breakdown := make(map[string]map[string]float64)
 	// 根据系统负载调整
 	maxJobs := 4.0
 
 	for _, n := range nodes {
-		cpuUsage, err := calculateCpuUsage(n)
-		if err != nil {
-			log.Printf("计算 cpu 使用, 节点 %s, 错误 %s\n", n.Name, err)
-			continue
-		}
-		cpuLoad := calculateLoad(*cpuUsage, math.Pow(2, 0.8))
+		// cpu 使用率由 manager 后台采集, 算分时不访问节点
+		cpuLoad := calculateLoad(n.CpuUsage, math.Pow(2, 0.8))
 		cpuCost := math.Pow(LIEB, cpuLoad) + math.Pow(LIEB, float64(n.TaskCount+1)/maxJobs) -
 			math.Pow(LIEB, cpuLoad) - math.Pow(LIEB, float64(n.TaskCount)/maxJobs)
 
@@ -109,43 +183,11 @@ func (E *EPvm) Score(t task.Task, nodes []*node.Node) map[string]float64 {
 		memCost := math.Pow(LIEB, newMemPercent) + math.Pow(LIEB, float64(n.TaskCount+1)/maxJobs) -
 			math.Pow(LIEB, memoryPercentAllocated) - math.Pow(LIEB, float64(n.TaskCount)/maxJobs)
 
-		nodeScores[n.Name] = cpuCost + memCost
+		scores := map[string]float64{"cpu": cpuCost, "memory": memCost}
+		breakdown[n.Name] = addConstraintScores(scores, t, n, nodes)
 	}
 
-	return nodeScores
-}
-
-// https://stackoverflow.com/a/23376195
-func calculateCpuUsage(n *node.Node) (*float64, error) {
-	stat1, err := n.GetStats()
-	if err != nil {
-		return nil, err
-	}
-	time.Sleep(3 * time.Second)
-	stat2, err := n.GetStats()
-	if err != nil {
-		return nil, err
-	}
-
-	stat1Idle := stat1.CpuStats.Idle + stat1.CpuStats.IOWait
-	stat2Idle := stat2.CpuStats.Idle + stat2.CpuStats.IOWait
-
-	stat1NonIdle := stat1.CpuStats.User + stat1.CpuStats.Nice + stat1.CpuStats.System + stat1.CpuStats.IRQ + stat1.CpuStats.SoftIRQ + stat1.CpuStats.Steal
-	stat2NonIdle := stat2.CpuStats.User + stat2.CpuStats.Nice + stat2.CpuStats.System + stat2.CpuStats.IRQ + stat2.CpuStats.SoftIRQ + stat2.CpuStats.Steal
-
-	stat1Total := stat1Idle + stat1NonIdle
-	stat2Total := stat2Idle + stat2NonIdle
-
-	total := stat2Total - stat1Total
-	idle := stat2Idle - stat1Idle
-
-	var cpuPercentUsage float64
-	if total == 0 && idle == 0 {
-		cpuPercentUsage = 0.00
-	} else {
-		cpuPercentUsage = (float64(total) - float64(idle)) / float64(total)
-	}
-	return &cpuPercentUsage, nil
+	return breakdown
 }
 
 func calculateLoad(usage float64, capacity float64) float64 {
@@ -0,0 +1,42 @@
+package scheduler
+
+import (
+	"cube/node"
+	"cube/task"
+	"errors"
+	"fmt"
+)
+
+func checkStatsFresh(t task.Task, n *node.Node, nodes []*node.Node) error {
+	if n.Stale {
+		return errors.New("节点统计信息已过期")
+	}
+	return nil
+}
+
+func checkSchedulable(t task.Task, n *node.Node, nodes []*node.Node) error {
+	if n.Unschedulable {
+		return errors.New("节点已被禁止调度")
+	}
+	return nil
+}
+
+func checkTaints(t task.Task, n *node.Node, nodes []*node.Node) error {
+	for _, taint := range n.Taints {
+		if taint.Effect == node.NoSchedule && !taint.ToleratedBy(t.Tolerations) {
+			return fmt.Errorf("任务不容忍节点污点 %s", taint)
+		}
+	}
+	return nil
+}
+
+// taintScore 对任务不容忍的 PreferNoSchedule 污点计算惩罚分
+func taintScore(t task.Task, n *node.Node) float64 {
+	score := 0.0
+	for _, taint := range n.Taints {
+		if taint.Effect == node.PreferNoSchedule && !taint.ToleratedBy(t.Tolerations) {
+			score += 1.0
+		}
+	}
+	return score
+}
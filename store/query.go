@@ -0,0 +1,345 @@
+package store
+
+import (
+	"cube/task"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"github.com/boltdb/bolt"
+	"sort"
+	"strings"
+)
+
+// 任务列表可以排序的字段, 默认按 ID 排序
+const (
+	SortByID    = "id"
+	SortByName  = "name"
+	SortByImage = "image"
+	SortByNode  = "node"
+	SortByState = "state"
+	SortByStart = "start"
+)
+
+// 各排序字段对应的排序值, 按字节序比较
+var sortFields = map[string]func(t *task.Task) string{
+	SortByName:  func(t *task.Task) string { return t.Name },
+	SortByImage: func(t *task.Task) string { return t.Image },
+	SortByNode:  func(t *task.Task) string { return t.Node },
+	SortByState: func(t *task.Task) string { return fmt.Sprintf("%03d", t.State) },
+	SortByStart: func(t *task.Task) string { return t.StartTime.UTC().Format("20060102150405.000000000") },
+}
+
+// TaskQuery 为空的字段不参与过滤
+type TaskQuery struct {
+	States []task.State
+	// 名称前缀
+	Name  string
+	Image string
+	Node  string
+	// 标签选择器
+	Selector task.Selector
+	// 排序字段, 为空时按 ID 排序
+	SortBy string
+	Desc   bool
+	// 每页最多返回的任务数, 为 0 时不限制
+	Limit int
+	// 上一页返回的 NextCursor, 从上一页最后一个任务之后继续读取
+	Cursor string
+}
+
+// TaskPage 一页任务, NextCursor 为空表示没有下一页
+type TaskPage struct {
+	Tasks      []*task.Task
+	NextCursor string
+}
+
+// TaskQuerier 由任务存储实现, 在存储内完成过滤, 排序和分页
+type TaskQuerier interface {
+	Query(q TaskQuery) (TaskPage, error)
+}
+
+func (q TaskQuery) Validate() error {
+	if q.SortBy != "" && q.SortBy != SortByID {
+		if _, ok := sortFields[q.SortBy]; !ok {
+			return fmt.Errorf("不支持的排序字段 %s", q.SortBy)
+		}
+	}
+	if q.Limit < 0 {
+		return fmt.Errorf("无效的分页大小 %d", q.Limit)
+	}
+	if _, err := decodeCursor(q.Cursor); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (q TaskQuery) Match(t *task.Task) bool {
+	if len(q.States) > 0 && !task.Contains(q.States, t.State) {
+		return false
+	}
+	if q.Name != "" && !strings.HasPrefix(t.Name, q.Name) {
+		return false
+	}
+	if q.Image != "" && t.Image != q.Image {
+		return false
+	}
+	if q.Node != "" && t.Node != q.Node {
+		return false
+	}
+	return q.Selector.Matches(t.Labels)
+}
+
+// sortKey 任务在排序中的位置, 排序值相同时按 ID 排序。按 ID 排序时即为任务 ID
+func sortKey(t *task.Task, sortBy string) string {
+	f, ok := sortFields[sortBy]
+	if !ok {
+		return t.ID.String()
+	}
+	return f(t) + "\x00" + t.ID.String()
+}
+
+// 游标为上一页最后一个任务的 sortKey
+func encodeCursor(key string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(key))
+}
+
+func decodeCursor(cursor string) (string, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return "", fmt.Errorf("无效的游标 %s", cursor)
+	}
+	return string(b), nil
+}
+
+// index 将任务的 sortKey 插入各排序字段 (包括 ID) 的有序索引, 调用方持有写锁
+func (i *InMemoryTaskStore) index(t *task.Task) {
+	for _, sortBy := range indexFields() {
+		keys := i.indexes[sortBy]
+		k := sortKey(t, sortBy)
+		n := sort.SearchStrings(keys, k)
+		keys = append(keys, "")
+		copy(keys[n+1:], keys[n:])
+		keys[n] = k
+		i.indexes[sortBy] = keys
+	}
+}
+
+// unindex 从索引中删除任务原来的 sortKey, t 为空时任务不存在
+func (i *InMemoryTaskStore) unindex(t *task.Task) {
+	if t == nil {
+		return
+	}
+	for _, sortBy := range indexFields() {
+		keys := i.indexes[sortBy]
+		k := sortKey(t, sortBy)
+		if n := sort.SearchStrings(keys, k); n < len(keys) && keys[n] == k {
+			i.indexes[sortBy] = append(keys[:n], keys[n+1:]...)
+		}
+	}
+}
+
+func indexFields() []string {
+	fields := []string{SortByID}
+	for sortBy := range sortFields {
+		fields = append(fields, sortBy)
+	}
+	return fields
+}
+
+// Query 沿排序字段的索引从游标位置开始遍历, 取到一页后停止
+func (i *InMemoryTaskStore) Query(q TaskQuery) (TaskPage, error) {
+	if err := q.Validate(); err != nil {
+		return TaskPage{}, err
+	}
+	after, _ := decodeCursor(q.Cursor)
+	sortBy := q.SortBy
+	if _, ok := sortFields[sortBy]; !ok {
+		sortBy = SortByID
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	keys := i.indexes[sortBy]
+
+	// n 为第一个要访问的键的位置, 倒序时从 n 向前遍历
+	var n int
+	switch {
+	case after == "" && q.Desc:
+		n = len(keys) - 1
+	case after == "":
+		n = 0
+	case q.Desc:
+		n = sort.SearchStrings(keys, after) - 1
+	default:
+		n = sort.Search(len(keys), func(j int) bool { return keys[j] > after })
+	}
+	step := 1
+	if q.Desc {
+		step = -1
+	}
+
+	page := TaskPage{Tasks: []*task.Task{}}
+	var lastKey string
+	for ; n >= 0 && n < len(keys); n += step {
+		id := keys[n]
+		if j := strings.LastIndexByte(id, 0); j >= 0 {
+			id = id[j+1:]
+		}
+		t, ok := i.Db[id]
+		if !ok || !q.Match(t) {
+			continue
+		}
+		if q.Limit > 0 && len(page.Tasks) == q.Limit {
+			page.NextCursor = encodeCursor(lastKey)
+			break
+		}
+		c, err := cloneTask(t)
+		if err != nil {
+			return TaskPage{}, err
+		}
+		page.Tasks = append(page.Tasks, c)
+		lastKey = keys[n]
+	}
+	return page, nil
+}
+
+// indexBucket 按排序字段建立的索引, 键为 sortKey, 值为空
+func (ts *TaskStore) indexBucket(sortBy string) []byte {
+	return []byte(ts.Bucket + "_by_" + sortBy)
+}
+
+// createIndexes 创建索引 bucket, 新创建的索引根据已有任务重建
+func (ts *TaskStore) createIndexes() error {
+	return ts.Db.Update(func(tx *bolt.Tx) error {
+		var created []string
+		for sortBy := range sortFields {
+			if tx.Bucket(ts.indexBucket(sortBy)) != nil {
+				continue
+			}
+			if _, err := tx.CreateBucket(ts.indexBucket(sortBy)); err != nil {
+				return fmt.Errorf("创建索引 %s, 错误: %v", sortBy, err)
+			}
+			created = append(created, sortBy)
+		}
+		if k, _ := tx.Bucket([]byte(ts.Bucket)).Cursor().First(); len(created) == 0 || k == nil {
+			return nil
+		}
+
+		logger.Info("重建任务索引", "bucket", ts.Bucket, "fields", created)
+		return tx.Bucket([]byte(ts.Bucket)).ForEach(func(k, v []byte) error {
+			var t task.Task
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			for _, sortBy := range created {
+				if err := tx.Bucket(ts.indexBucket(sortBy)).Put([]byte(sortKey(&t, sortBy)), nil); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+	})
+}
+
+func (ts *TaskStore) index(tx *bolt.Tx, t *task.Task) error {
+	for sortBy := range sortFields {
+		if err := tx.Bucket(ts.indexBucket(sortBy)).Put([]byte(sortKey(t, sortBy)), nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// unindex 删除任务原来的索引, data 为任务原来的值, 为空时任务不存在
+func (ts *TaskStore) unindex(tx *bolt.Tx, data []byte) error {
+	if data == nil {
+		return nil
+	}
+	var t task.Task
+	if err := json.Unmarshal(data, &t); err != nil {
+		return err
+	}
+	for sortBy := range sortFields {
+		if err := tx.Bucket(ts.indexBucket(sortBy)).Delete([]byte(sortKey(&t, sortBy))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Query 沿任务 bucket (按 ID 排序) 或者排序字段的索引从游标位置开始遍历, 取到一页后停止
+func (ts *TaskStore) Query(q TaskQuery) (TaskPage, error) {
+	if err := q.Validate(); err != nil {
+		return TaskPage{}, err
+	}
+	after, _ := decodeCursor(q.Cursor)
+
+	page := TaskPage{Tasks: []*task.Task{}}
+	err := ts.Db.View(func(tx *bolt.Tx) error {
+		tasks := tx.Bucket([]byte(ts.Bucket))
+		b := tasks
+		if _, ok := sortFields[q.SortBy]; ok {
+			b = tx.Bucket(ts.indexBucket(q.SortBy))
+		}
+
+		c := b.Cursor()
+		var k []byte
+		switch {
+		case after == "" && q.Desc:
+			k, _ = c.Last()
+		case after == "":
+			k, _ = c.First()
+		case q.Desc:
+			// Seek 返回第一个不小于游标的键, 它的前一个键小于游标
+			if k, _ = c.Seek([]byte(after)); k == nil {
+				k, _ = c.Last()
+			} else {
+				k, _ = c.Prev()
+			}
+		default:
+			if k, _ = c.Seek([]byte(after)); k != nil && string(k) == after {
+				k, _ = c.Next()
+			}
+		}
+
+		var lastKey string
+		for ; k != nil; k = next(c, q.Desc) {
+			id := string(k)
+			if i := strings.LastIndexByte(id, 0); i >= 0 {
+				id = id[i+1:]
+			}
+			v := tasks.Get([]byte(id))
+			if v == nil {
+				continue
+			}
+			var t task.Task
+			if err := json.Unmarshal(v, &t); err != nil {
+				return err
+			}
+			if !q.Match(&t) {
+				continue
+			}
+			if q.Limit > 0 && len(page.Tasks) == q.Limit {
+				page.NextCursor = encodeCursor(lastKey)
+				return nil
+			}
+			page.Tasks = append(page.Tasks, &t)
+			lastKey = string(k)
+		}
+		return nil
+	})
+	if err != nil {
+		return TaskPage{}, err
+	}
+	return page, nil
+}
+
+func next(c *bolt.Cursor, desc bool) []byte {
+	var k []byte
+	if desc {
+		k, _ = c.Prev()
+	} else {
+		k, _ = c.Next()
+	}
+	return k
+}
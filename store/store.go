@@ -1,28 +1,37 @@
 package store
 
 import (
+	"cube/logging"
 	"cube/task"
 	"encoding/json"
 	"fmt"
 	"github.com/boltdb/bolt"
-	"log"
 	"os"
+	"sync"
 )
 
+var logger = logging.Component("store")
+
 type Store interface {
 	Put(key string, value any) error
 	Get(key string) (any, error)
 	List() (any, error)
 	Count() (int, error)
+	Delete(key string) error
 }
 
+// InMemoryTaskStore 与持久化存储一样保存和返回任务的副本, 调用方修改任务后需要重新 Put
 type InMemoryTaskStore struct {
+	mu sync.RWMutex
 	Db map[string]*task.Task
+	// 各排序字段的有序 sortKey, 用于 Query
+	indexes map[string][]string
 }
 
 func NewInMemoryTaskStore() *InMemoryTaskStore {
 	return &InMemoryTaskStore{
-		Db: make(map[string]*task.Task),
+		Db:      make(map[string]*task.Task),
+		indexes: make(map[string][]string),
 	}
 }
 
@@ -31,31 +40,71 @@ func (i *InMemoryTaskStore) Put(key string, value any) error {
 	if !ok {
 		return fmt.Errorf("值不是任务类型 %v", value)
 	}
-	i.Db[key] = t
+	c, err := cloneTask(t)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.unindex(i.Db[key])
+	i.Db[key] = c
+	i.index(c)
 	return nil
 }
 
 func (i *InMemoryTaskStore) Get(key string) (any, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	t, ok := i.Db[key]
 	if !ok {
 		return nil, fmt.Errorf("任务 %v 不存在", key)
 	}
 
-	return t, nil
+	return cloneTask(t)
 }
 
 func (i *InMemoryTaskStore) List() (any, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	var tasks []*task.Task
 	for _, t := range i.Db {
-		tasks = append(tasks, t)
+		c, err := cloneTask(t)
+		if err != nil {
+			return nil, err
+		}
+		tasks = append(tasks, c)
 	}
 	return tasks, nil
 }
 
+// cloneTask 与持久化存储一样通过 json 复制任务, 存储的任务不与调用方共享 map, 切片和指针字段
+func cloneTask(t *task.Task) (*task.Task, error) {
+	data, err := json.Marshal(t)
+	if err != nil {
+		return nil, err
+	}
+	var c task.Task
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
 func (i *InMemoryTaskStore) Count() (int, error) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
 	return len(i.Db), nil
 }
 
+func (i *InMemoryTaskStore) Delete(key string) error {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.unindex(i.Db[key])
+	delete(i.Db, key)
+	return nil
+}
+
 type InMemoryTaskEventStore struct {
 	Db map[string]*task.Event
 }
@@ -96,6 +145,11 @@ func (i *InMemoryTaskEventStore) Count() (int, error) {
 	return len(i.Db), nil
 }
 
+func (i *InMemoryTaskEventStore) Delete(key string) error {
+	delete(i.Db, key)
+	return nil
+}
+
 type TaskStore struct {
 	Db        *bolt.DB
 	DbFile    string
@@ -116,7 +170,10 @@ func NewTaskStore(file string, model os.FileMode, bucket string) (*TaskStore, er
 	}
 	err = t.CreateBucket()
 	if err != nil {
-		log.Printf("bucket: %v 已存在", t.Bucket)
+		logger.Debug("bucket 已存在", "bucket", t.Bucket)
+	}
+	if err := t.createIndexes(); err != nil {
+		return nil, err
 	}
 
 	return &t, nil
@@ -136,20 +193,34 @@ func (ts *TaskStore) Close() error {
 	return ts.Db.Close()
 }
 
+func (ts *TaskStore) Delete(key string) error {
+	return ts.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ts.Bucket))
+		if err := ts.unindex(tx, b.Get([]byte(key))); err != nil {
+			return err
+		}
+		return b.Delete([]byte(key))
+	})
+}
+
 func (ts *TaskStore) Put(key string, value any) error {
 	return ts.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(ts.Bucket))
 
-		buf, err := json.Marshal(value.(*task.Task))
+		t := value.(*task.Task)
+		buf, err := json.Marshal(t)
 		if err != nil {
 			return err
 		}
 
+		if err := ts.unindex(tx, b.Get([]byte(key))); err != nil {
+			return err
+		}
 		err = b.Put([]byte(key), buf)
 		if err != nil {
 			return err
 		}
-		return nil
+		return ts.index(tx, t)
 	})
 }
 
@@ -230,7 +301,7 @@ func NewTaskEventStore(file string, model os.FileMode, bucket string) (*TaskEven
 	}
 	err = te.CreateBucket()
 	if err != nil {
-		log.Printf("bucket %v 已存在", te.Bucket)
+		logger.Debug("bucket 已存在", "bucket", te.Bucket)
 	}
 
 	return &te, nil
@@ -250,6 +321,13 @@ func (tes *TaskEventStore) Close() error {
 	return tes.Db.Close()
 }
 
+func (tes *TaskEventStore) Delete(key string) error {
+	return tes.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(tes.Bucket))
+		return b.Delete([]byte(key))
+	})
+}
+
 func (tes *TaskEventStore) Put(key string, value any) error {
 	return tes.Db.Update(func(tx *bolt.Tx) error {
 		b := tx.Bucket([]byte(tes.Bucket))
@@ -323,3 +401,627 @@ func (tes *TaskEventStore) Count() (int, error) {
 	}
 	return taskCount, nil
 }
+
+type InMemoryCronTaskStore struct {
+	Db map[string]*task.CronTask
+}
+
+func NewInMemoryCronTaskStore() *InMemoryCronTaskStore {
+	return &InMemoryCronTaskStore{
+		Db: make(map[string]*task.CronTask),
+	}
+}
+
+func (i *InMemoryCronTaskStore) Put(key string, value any) error {
+	c, ok := value.(*task.CronTask)
+	if !ok {
+		return fmt.Errorf("值不是定时任务类型 %v", value)
+	}
+	i.Db[key] = c
+	return nil
+}
+
+func (i *InMemoryCronTaskStore) Get(key string) (any, error) {
+	c, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("定时任务 %v 不存在", key)
+	}
+
+	return c, nil
+}
+
+func (i *InMemoryCronTaskStore) List() (any, error) {
+	var cronTasks []*task.CronTask
+	for _, c := range i.Db {
+		cronTasks = append(cronTasks, c)
+	}
+	return cronTasks, nil
+}
+
+func (i *InMemoryCronTaskStore) Count() (int, error) {
+	return len(i.Db), nil
+}
+
+func (i *InMemoryCronTaskStore) Delete(key string) error {
+	delete(i.Db, key)
+	return nil
+}
+
+type CronTaskStore struct {
+	Db        *bolt.DB
+	DbFile    string
+	FileModel os.FileMode
+	Bucket    string
+}
+
+func NewCronTaskStore(file string, model os.FileMode, bucket string) (*CronTaskStore, error) {
+	db, err := bolt.Open(file, model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 %v", file)
+	}
+	c := CronTaskStore{
+		Db:        db,
+		DbFile:    file,
+		FileModel: model,
+		Bucket:    bucket,
+	}
+	err = c.CreateBucket()
+	if err != nil {
+		logger.Debug("bucket 已存在", "bucket", c.Bucket)
+	}
+
+	return &c, nil
+}
+
+func (cs *CronTaskStore) CreateBucket() error {
+	return cs.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(cs.Bucket))
+		if err != nil {
+			return fmt.Errorf("创建 bucket %s, 错误: %v", cs.Bucket, err)
+		}
+		return nil
+	})
+}
+
+func (cs *CronTaskStore) Close() error {
+	return cs.Db.Close()
+}
+
+func (cs *CronTaskStore) Delete(key string) error {
+	return cs.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cs.Bucket))
+		return b.Delete([]byte(key))
+	})
+}
+
+func (cs *CronTaskStore) Put(key string, value any) error {
+	return cs.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cs.Bucket))
+
+		buf, err := json.Marshal(value.(*task.CronTask))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), buf)
+	})
+}
+
+func (cs *CronTaskStore) Get(key string) (any, error) {
+	var c task.CronTask
+	err := cs.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cs.Bucket))
+		ct := b.Get([]byte(key))
+		if ct == nil {
+			return fmt.Errorf("定时任务 %v 未找到", key)
+		}
+		return json.Unmarshal(ct, &c)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (cs *CronTaskStore) List() (any, error) {
+	var cronTasks []*task.CronTask
+	err := cs.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cs.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			var c *task.CronTask
+			err := json.Unmarshal(v, &c)
+			if err != nil {
+				return err
+			}
+			cronTasks = append(cronTasks, c)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return cronTasks, nil
+}
+
+func (cs *CronTaskStore) Count() (int, error) {
+	count := 0
+	err := cs.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(cs.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+type InMemoryWorkflowStore struct {
+	Db map[string]*task.Workflow
+}
+
+func NewInMemoryWorkflowStore() *InMemoryWorkflowStore {
+	return &InMemoryWorkflowStore{
+		Db: make(map[string]*task.Workflow),
+	}
+}
+
+func (i *InMemoryWorkflowStore) Put(key string, value any) error {
+	wf, ok := value.(*task.Workflow)
+	if !ok {
+		return fmt.Errorf("值不是工作流类型 %v", value)
+	}
+	i.Db[key] = wf
+	return nil
+}
+
+func (i *InMemoryWorkflowStore) Get(key string) (any, error) {
+	wf, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("工作流 %v 不存在", key)
+	}
+
+	return wf, nil
+}
+
+func (i *InMemoryWorkflowStore) List() (any, error) {
+	var workflows []*task.Workflow
+	for _, wf := range i.Db {
+		workflows = append(workflows, wf)
+	}
+	return workflows, nil
+}
+
+func (i *InMemoryWorkflowStore) Count() (int, error) {
+	return len(i.Db), nil
+}
+
+func (i *InMemoryWorkflowStore) Delete(key string) error {
+	delete(i.Db, key)
+	return nil
+}
+
+type WorkflowStore struct {
+	Db        *bolt.DB
+	DbFile    string
+	FileModel os.FileMode
+	Bucket    string
+}
+
+func NewWorkflowStore(file string, model os.FileMode, bucket string) (*WorkflowStore, error) {
+	db, err := bolt.Open(file, model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 %v", file)
+	}
+	ws := WorkflowStore{
+		Db:        db,
+		DbFile:    file,
+		FileModel: model,
+		Bucket:    bucket,
+	}
+	err = ws.CreateBucket()
+	if err != nil {
+		logger.Debug("bucket 已存在", "bucket", ws.Bucket)
+	}
+
+	return &ws, nil
+}
+
+func (ws *WorkflowStore) CreateBucket() error {
+	return ws.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(ws.Bucket))
+		if err != nil {
+			return fmt.Errorf("创建 bucket %s, 错误: %v", ws.Bucket, err)
+		}
+		return nil
+	})
+}
+
+func (ws *WorkflowStore) Close() error {
+	return ws.Db.Close()
+}
+
+func (ws *WorkflowStore) Delete(key string) error {
+	return ws.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ws.Bucket))
+		return b.Delete([]byte(key))
+	})
+}
+
+func (ws *WorkflowStore) Put(key string, value any) error {
+	return ws.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ws.Bucket))
+
+		buf, err := json.Marshal(value.(*task.Workflow))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), buf)
+	})
+}
+
+func (ws *WorkflowStore) Get(key string) (any, error) {
+	var wf task.Workflow
+	err := ws.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ws.Bucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("工作流 %v 未找到", key)
+		}
+		return json.Unmarshal(data, &wf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &wf, nil
+}
+
+func (ws *WorkflowStore) List() (any, error) {
+	var workflows []*task.Workflow
+	err := ws.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ws.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			var wf *task.Workflow
+			err := json.Unmarshal(v, &wf)
+			if err != nil {
+				return err
+			}
+			workflows = append(workflows, wf)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return workflows, nil
+}
+
+func (ws *WorkflowStore) Count() (int, error) {
+	count := 0
+	err := ws.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(ws.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+type InMemoryAutoscalerStore struct {
+	Db map[string]*task.Autoscaler
+}
+
+func NewInMemoryAutoscalerStore() *InMemoryAutoscalerStore {
+	return &InMemoryAutoscalerStore{
+		Db: make(map[string]*task.Autoscaler),
+	}
+}
+
+func (i *InMemoryAutoscalerStore) Put(key string, value any) error {
+	a, ok := value.(*task.Autoscaler)
+	if !ok {
+		return fmt.Errorf("值不是自动扩缩容类型 %v", value)
+	}
+	i.Db[key] = a
+	return nil
+}
+
+func (i *InMemoryAutoscalerStore) Get(key string) (any, error) {
+	a, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("自动扩缩容 %v 不存在", key)
+	}
+
+	return a, nil
+}
+
+func (i *InMemoryAutoscalerStore) List() (any, error) {
+	var autoscalers []*task.Autoscaler
+	for _, a := range i.Db {
+		autoscalers = append(autoscalers, a)
+	}
+	return autoscalers, nil
+}
+
+func (i *InMemoryAutoscalerStore) Count() (int, error) {
+	return len(i.Db), nil
+}
+
+func (i *InMemoryAutoscalerStore) Delete(key string) error {
+	delete(i.Db, key)
+	return nil
+}
+
+type AutoscalerStore struct {
+	Db        *bolt.DB
+	DbFile    string
+	FileModel os.FileMode
+	Bucket    string
+}
+
+func NewAutoscalerStore(file string, model os.FileMode, bucket string) (*AutoscalerStore, error) {
+	db, err := bolt.Open(file, model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 %v", file)
+	}
+	as := AutoscalerStore{
+		Db:        db,
+		DbFile:    file,
+		FileModel: model,
+		Bucket:    bucket,
+	}
+	err = as.CreateBucket()
+	if err != nil {
+		logger.Debug("bucket 已存在", "bucket", as.Bucket)
+	}
+
+	return &as, nil
+}
+
+func (as *AutoscalerStore) CreateBucket() error {
+	return as.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(as.Bucket))
+		if err != nil {
+			return fmt.Errorf("创建 bucket %s, 错误: %v", as.Bucket, err)
+		}
+		return nil
+	})
+}
+
+func (as *AutoscalerStore) Close() error {
+	return as.Db.Close()
+}
+
+func (as *AutoscalerStore) Delete(key string) error {
+	return as.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(as.Bucket))
+		return b.Delete([]byte(key))
+	})
+}
+
+func (as *AutoscalerStore) Put(key string, value any) error {
+	return as.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(as.Bucket))
+
+		buf, err := json.Marshal(value.(*task.Autoscaler))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), buf)
+	})
+}
+
+func (as *AutoscalerStore) Get(key string) (any, error) {
+	var a task.Autoscaler
+	err := as.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(as.Bucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("自动扩缩容 %v 未找到", key)
+		}
+		return json.Unmarshal(data, &a)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+func (as *AutoscalerStore) List() (any, error) {
+	var autoscalers []*task.Autoscaler
+	err := as.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(as.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			var a *task.Autoscaler
+			err := json.Unmarshal(v, &a)
+			if err != nil {
+				return err
+			}
+			autoscalers = append(autoscalers, a)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return autoscalers, nil
+}
+
+func (as *AutoscalerStore) Count() (int, error) {
+	count := 0
+	err := as.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(as.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
+
+type InMemoryClusterEventStore struct {
+	Db map[string]*task.ClusterEvent
+}
+
+func NewInMemoryClusterEventStore() *InMemoryClusterEventStore {
+	return &InMemoryClusterEventStore{
+		Db: make(map[string]*task.ClusterEvent),
+	}
+}
+
+func (i *InMemoryClusterEventStore) Put(key string, value any) error {
+	e, ok := value.(*task.ClusterEvent)
+	if !ok {
+		return fmt.Errorf("值不是集群事件类型 %v", value)
+	}
+	i.Db[key] = e
+	return nil
+}
+
+func (i *InMemoryClusterEventStore) Get(key string) (any, error) {
+	e, ok := i.Db[key]
+	if !ok {
+		return nil, fmt.Errorf("集群事件 %v 不存在", key)
+	}
+
+	return e, nil
+}
+
+func (i *InMemoryClusterEventStore) List() (any, error) {
+	var events []*task.ClusterEvent
+	for _, e := range i.Db {
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (i *InMemoryClusterEventStore) Count() (int, error) {
+	return len(i.Db), nil
+}
+
+func (i *InMemoryClusterEventStore) Delete(key string) error {
+	delete(i.Db, key)
+	return nil
+}
+
+type ClusterEventStore struct {
+	Db        *bolt.DB
+	DbFile    string
+	FileModel os.FileMode
+	Bucket    string
+}
+
+func NewClusterEventStore(file string, model os.FileMode, bucket string) (*ClusterEventStore, error) {
+	db, err := bolt.Open(file, model, nil)
+	if err != nil {
+		return nil, fmt.Errorf("无法打开 %v", file)
+	}
+	e := ClusterEventStore{
+		Db:        db,
+		DbFile:    file,
+		FileModel: model,
+		Bucket:    bucket,
+	}
+	err = e.CreateBucket()
+	if err != nil {
+		logger.Debug("bucket 已存在", "bucket", e.Bucket)
+	}
+
+	return &e, nil
+}
+
+func (es *ClusterEventStore) CreateBucket() error {
+	return es.Db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucket([]byte(es.Bucket))
+		if err != nil {
+			return fmt.Errorf("创建 bucket %s, 错误: %v", es.Bucket, err)
+		}
+		return nil
+	})
+}
+
+func (es *ClusterEventStore) Close() error {
+	return es.Db.Close()
+}
+
+func (es *ClusterEventStore) Delete(key string) error {
+	return es.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(es.Bucket))
+		return b.Delete([]byte(key))
+	})
+}
+
+func (es *ClusterEventStore) Put(key string, value any) error {
+	return es.Db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(es.Bucket))
+
+		buf, err := json.Marshal(value.(*task.ClusterEvent))
+		if err != nil {
+			return err
+		}
+
+		return b.Put([]byte(key), buf)
+	})
+}
+
+func (es *ClusterEventStore) Get(key string) (any, error) {
+	var e task.ClusterEvent
+	err := es.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(es.Bucket))
+		data := b.Get([]byte(key))
+		if data == nil {
+			return fmt.Errorf("集群事件 %v 未找到", key)
+		}
+		return json.Unmarshal(data, &e)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func (es *ClusterEventStore) List() (any, error) {
+	var events []*task.ClusterEvent
+	err := es.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(es.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			var e *task.ClusterEvent
+			err := json.Unmarshal(v, &e)
+			if err != nil {
+				return err
+			}
+			events = append(events, e)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (es *ClusterEventStore) Count() (int, error) {
+	count := 0
+	err := es.Db.View(func(tx *bolt.Tx) error {
+		b := tx.Bucket([]byte(es.Bucket))
+		return b.ForEach(func(k, v []byte) error {
+			count++
+			return nil
+		})
+	})
+	if err != nil {
+		return -1, err
+	}
+	return count, nil
+}
@@ -0,0 +1,35 @@
+package task
+
+const (
+	DoNotSchedule  = "DoNotSchedule"
+	ScheduleAnyway = "ScheduleAnyway"
+)
+
+// AntiAffinityTerm 要求任务不与标签匹配 Labels 的任务位于同一拓扑域,
+// TopologyKey 为空时拓扑域为单个节点
+type AntiAffinityTerm struct {
+	Labels      map[string]string
+	TopologyKey string
+}
+
+// TopologySpreadConstraint 要求标签匹配 Labels 的任务在 TopologyKey 划分的拓扑域之间均匀分布,
+// 各拓扑域任务数之差不超过 MaxSkew
+type TopologySpreadConstraint struct {
+	Labels            map[string]string
+	TopologyKey       string
+	MaxSkew           int
+	WhenUnsatisfiable string
+}
+
+// MatchLabels 判断 labels 是否包含 selector 中的全部键值对, selector 为空时不匹配任何任务
+func MatchLabels(selector map[string]string, labels map[string]string) bool {
+	if len(selector) == 0 {
+		return false
+	}
+	for k, v := range selector {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
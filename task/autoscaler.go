@@ -0,0 +1,123 @@
+package task
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+const (
+	defaultScaleUpStabilizationSeconds   = 0
+	defaultScaleDownStabilizationSeconds = 300
+	// 最多保留的扩缩容事件数
+	maxScalingEvents = 100
+)
+
+// Autoscaler 根据标签匹配 Selector 的任务 (服务副本) 的资源使用率调整副本数,
+// 新副本以 Template 创建
+type Autoscaler struct {
+	ID          uuid.UUID
+	Name        string
+	Selector    map[string]string
+	Template    Task
+	MinReplicas int
+	MaxReplicas int
+	// 目标 CPU 和内存使用率, 为副本使用量相对于 Template 请求的 Cpu 和 Memory 的百分比, 至少设置一个
+	TargetCPUUtilization    float64
+	TargetMemoryUtilization float64
+	// 扩容和缩容的稳定窗口秒数, 在窗口内取最保守的建议副本数, 为空时分别为 0 和 300
+	ScaleUpStabilizationSeconds   *int
+	ScaleDownStabilizationSeconds *int
+
+	CurrentReplicas          int
+	DesiredReplicas          int
+	CurrentCPUUtilization    float64
+	CurrentMemoryUtilization float64
+	LastScaleTime            time.Time
+	Events                   []ScalingEvent
+	// 稳定窗口内的建议副本数
+	Recommendations []Recommendation
+}
+
+type ScalingEvent struct {
+	Time   time.Time
+	From   int
+	To     int
+	Reason string
+}
+
+type Recommendation struct {
+	Time     time.Time
+	Replicas int
+}
+
+func (a *Autoscaler) Validate() error {
+	if len(a.Selector) == 0 {
+		return fmt.Errorf("自动扩缩容没有指定 Selector")
+	}
+	if a.Template.Image == "" {
+		return fmt.Errorf("自动扩缩容模板没有指定镜像")
+	}
+	if !MatchLabels(a.Selector, a.Template.Labels) {
+		return fmt.Errorf("模板标签 %v 与 Selector %v 不匹配", a.Template.Labels, a.Selector)
+	}
+	if a.MinReplicas < 1 || a.MaxReplicas < a.MinReplicas {
+		return fmt.Errorf("副本数范围无效: %d-%d", a.MinReplicas, a.MaxReplicas)
+	}
+	if a.TargetCPUUtilization <= 0 && a.TargetMemoryUtilization <= 0 {
+		return fmt.Errorf("至少需要设置目标 CPU 或者内存使用率")
+	}
+	if a.TargetCPUUtilization > 0 && a.Template.Cpu <= 0 {
+		return fmt.Errorf("按 CPU 使用率扩缩容时模板需要请求 Cpu")
+	}
+	if a.TargetMemoryUtilization > 0 && a.Template.Memory <= 0 {
+		return fmt.Errorf("按内存使用率扩缩容时模板需要请求 Memory")
+	}
+	return nil
+}
+
+// Stabilize 记录本次建议副本数, 扩容时取扩容窗口内的最小建议值, 缩容时取缩容窗口内的最大建议值,
+// 避免使用率波动导致副本数反复变化
+func (a *Autoscaler) Stabilize(now time.Time, current int, recommended int) int {
+	up, down := defaultScaleUpStabilizationSeconds, defaultScaleDownStabilizationSeconds
+	if a.ScaleUpStabilizationSeconds != nil {
+		up = *a.ScaleUpStabilizationSeconds
+	}
+	if a.ScaleDownStabilizationSeconds != nil {
+		down = *a.ScaleDownStabilizationSeconds
+	}
+	upWindow := now.Add(-time.Duration(up) * time.Second)
+	downWindow := now.Add(-time.Duration(down) * time.Second)
+
+	a.Recommendations = append(a.Recommendations, Recommendation{Time: now, Replicas: recommended})
+	upCandidate, downCandidate := recommended, recommended
+	var kept []Recommendation
+	for _, r := range a.Recommendations {
+		if r.Time.Before(upWindow) && r.Time.Before(downWindow) {
+			continue
+		}
+		kept = append(kept, r)
+		if !r.Time.Before(upWindow) && r.Replicas < upCandidate {
+			upCandidate = r.Replicas
+		}
+		if !r.Time.Before(downWindow) && r.Replicas > downCandidate {
+			downCandidate = r.Replicas
+		}
+	}
+	a.Recommendations = kept
+
+	switch {
+	case upCandidate > current:
+		return upCandidate
+	case downCandidate < current:
+		return downCandidate
+	}
+	return current
+}
+
+func (a *Autoscaler) RecordEvent(e ScalingEvent) {
+	a.Events = append(a.Events, e)
+	if n := len(a.Events); n > maxScalingEvents {
+		a.Events = a.Events[n-maxScalingEvents:]
+	}
+}
@@ -0,0 +1,17 @@
+package task
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// ClusterEvent 记录任务和节点发生的变化, Seq 按记录顺序递增, 用于 watch 断开后继续读取
+type ClusterEvent struct {
+	Seq     uint64
+	Time    time.Time
+	Type    string
+	Reason  string
+	Message string
+	TaskID  uuid.UUID
+	Node    string
+}
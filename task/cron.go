@@ -0,0 +1,124 @@
+package task
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+	"time"
+)
+
+// ConcurrencyPolicy 上一次运行尚未结束时, 到达下一次运行时间的处理方式
+type ConcurrencyPolicy string
+
+const (
+	// 允许多次运行同时进行
+	ConcurrencyAllow ConcurrencyPolicy = "Allow"
+	// 跳过本次运行
+	ConcurrencyForbid ConcurrencyPolicy = "Forbid"
+	// 停止正在进行的运行, 再开始本次运行
+	ConcurrencyReplace ConcurrencyPolicy = "Replace"
+)
+
+const (
+	defaultSuccessfulHistoryLimit = 3
+	defaultFailedHistoryLimit     = 1
+	// 最多记录的错过运行时间
+	maxMissedRuns = 20
+)
+
+// CronTask 按 cron 表达式定期以 Task 为模板创建任务
+type CronTask struct {
+	ID       uuid.UUID
+	Name     string
+	Schedule string
+	// IANA 时区名称, 例如 Asia/Shanghai, 为空时使用 UTC
+	TimeZone          string
+	ConcurrencyPolicy ConcurrencyPolicy
+	// 错过运行时间后仍然补运行的最长时间, 为空时不限制
+	StartingDeadlineSeconds *int
+	// 保留的成功和失败运行记录数, 为空时分别保留 3 条和 1 条
+	SuccessfulHistoryLimit *int
+	FailedHistoryLimit     *int
+	Task                   Task
+
+	LastScheduleTime time.Time
+	NextScheduleTime time.Time
+	// 正在进行的运行和已结束的运行
+	Active  []CronRun
+	History []CronRun
+	// manager 停止期间等原因错过的运行时间, 只保留最近的记录
+	MissedRuns     []time.Time
+	MissedRunCount int
+}
+
+type CronRun struct {
+	TaskID        uuid.UUID
+	ScheduledTime time.Time
+	State         State
+	FinishTime    time.Time
+}
+
+// Validate 检查 cron 表达式, 时区和并发策略, 返回解析后的表达式
+func (c *CronTask) Validate() (*CronSchedule, error) {
+	if c.Name == "" {
+		return nil, fmt.Errorf("定时任务没有名称")
+	}
+	if c.Task.Image == "" {
+		return nil, fmt.Errorf("定时任务没有指定镜像")
+	}
+	switch c.ConcurrencyPolicy {
+	case "":
+		c.ConcurrencyPolicy = ConcurrencyAllow
+	case ConcurrencyAllow, ConcurrencyForbid, ConcurrencyReplace:
+	default:
+		return nil, fmt.Errorf("无效的并发策略: %s", c.ConcurrencyPolicy)
+	}
+	if _, err := c.Location(); err != nil {
+		return nil, err
+	}
+	return ParseCron(c.Schedule)
+}
+
+func (c *CronTask) Location() (*time.Location, error) {
+	if c.TimeZone == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(c.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("无效的时区 %s: %v", c.TimeZone, err)
+	}
+	return loc, nil
+}
+
+// RecordMissed 记录错过的运行时间
+func (c *CronTask) RecordMissed(times ...time.Time) {
+	c.MissedRunCount += len(times)
+	c.MissedRuns = append(c.MissedRuns, times...)
+	if n := len(c.MissedRuns); n > maxMissedRuns {
+		c.MissedRuns = c.MissedRuns[n-maxMissedRuns:]
+	}
+}
+
+// TrimHistory 按历史记录数限制只保留最近结束的成功和失败运行
+func (c *CronTask) TrimHistory() {
+	successful, failed := defaultSuccessfulHistoryLimit, defaultFailedHistoryLimit
+	if c.SuccessfulHistoryLimit != nil {
+		successful = *c.SuccessfulHistoryLimit
+	}
+	if c.FailedHistoryLimit != nil {
+		failed = *c.FailedHistoryLimit
+	}
+
+	var history []CronRun
+	for i := len(c.History) - 1; i >= 0; i-- {
+		r := c.History[i]
+		if r.State == Completed && successful > 0 {
+			successful--
+		} else if r.State != Completed && failed > 0 {
+			failed--
+		} else {
+			continue
+		}
+		history = append([]CronRun{r}, history...)
+	}
+	c.History = history
+}
@@ -0,0 +1,84 @@
+package task
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCronInvalid(t *testing.T) {
+	tests := []struct {
+		name string
+		expr string
+	}{
+		{"空表达式", ""},
+		{"字段数不足", "* * * *"},
+		{"字段数过多", "* * * * * *"},
+		{"分钟超出范围", "60 * * * *"},
+		{"小时超出范围", "* 24 * * *"},
+		{"日期为 0", "* * 0 * *"},
+		{"月份超出范围", "* * * 13 *"},
+		{"星期超出范围", "* * * * 8"},
+		{"步长为 0", "*/0 * * * *"},
+		{"步长不是数字", "*/x * * * *"},
+		{"范围颠倒", "5-1 * * * *"},
+		{"取值不是数字", "a * * * *"},
+		{"未知的月份缩写", "* * * foo *"},
+		{"未知的描述符", "@often"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCron(tt.expr); err == nil {
+				t.Errorf("ParseCron(%q) 应当返回错误", tt.expr)
+			}
+		})
+	}
+}
+
+func TestCronScheduleNext(t *testing.T) {
+	// 2024-01-15 是星期一
+	from := time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)
+	cst := time.FixedZone("UTC+8", 8*3600)
+
+	tests := []struct {
+		name string
+		expr string
+		from time.Time
+		want time.Time
+	}{
+		{"每分钟", "* * * * *", from, time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"秒数被截断", "* * * * *", from.Add(45 * time.Second), time.Date(2024, 1, 15, 10, 31, 0, 0, time.UTC)},
+		{"不包含起始时间", "30 10 * * *", from, time.Date(2024, 1, 16, 10, 30, 0, 0, time.UTC)},
+		{"每小时整点", "0 * * * *", from, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"步长", "*/15 * * * *", from, time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"起始值加步长", "5/20 * * * *", from, time.Date(2024, 1, 15, 10, 45, 0, 0, time.UTC)},
+		{"范围加步长", "0 8-18/4 * * *", from, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"列表", "0,10 11,23 * * *", from, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"每天", "0 9 * * *", from, time.Date(2024, 1, 16, 9, 0, 0, 0, time.UTC)},
+		{"每月 1 日", "0 0 1 * *", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"月份缩写", "0 12 * jan,jul *", from, time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)},
+		{"星期缩写", "0 0 * * sun", from, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"星期缩写不区分大小写", "0 0 * * SUN", from, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"星期日写作 7", "0 0 * * 7", from, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"工作日", "0 0 * * mon-fri", from, time.Date(2024, 1, 16, 0, 0, 0, 0, time.UTC)},
+		{"日期和星期满足其一", "0 0 13 * fri", from, time.Date(2024, 1, 19, 0, 0, 0, 0, time.UTC)},
+		{"日期为问号", "0 0 ? * mon", from, time.Date(2024, 1, 22, 0, 0, 0, 0, time.UTC)},
+		{"闰年 2 月 29 日", "0 0 29 2 *", from, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)},
+		{"跨年", "0 0 1 1 *", from, time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", "@hourly", from, time.Date(2024, 1, 15, 11, 0, 0, 0, time.UTC)},
+		{"@monthly", "@monthly", from, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", "@weekly", from, time.Date(2024, 1, 21, 0, 0, 0, 0, time.UTC)},
+		{"按起始时间的时区计算", "0 9 * * *", time.Date(2024, 1, 15, 10, 30, 0, 0, cst), time.Date(2024, 1, 16, 9, 0, 0, 0, cst)},
+		{"没有满足的时间", "0 0 30 2 *", from, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron(%q) 错误: %v", tt.expr, err)
+			}
+			if got := s.Next(tt.from); !got.Equal(tt.want) {
+				t.Errorf("Next(%v) = %v, 期望 %v", tt.from, got, tt.want)
+			}
+		})
+	}
+}
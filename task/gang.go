@@ -0,0 +1,17 @@
+package task
+
+import (
+	"github.com/google/uuid"
+	"time"
+)
+
+// Gang 一组必须同时调度的任务, 所有成员都找到节点时才一起下发, 否则都不下发
+type Gang struct {
+	ID    uuid.UUID
+	Name  string
+	State State
+	Tasks []Task
+	// 下发失败的次数, 以及失败后下次重试的时间
+	Attempts   int
+	RetryAfter time.Time
+}
@@ -0,0 +1,173 @@
+package task
+
+import (
+	"context"
+	"fmt"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+// 钩子执行的超时时间, 以及初始化容器默认的超时时间
+const (
+	hookTimeout = 30 * time.Second
+	initTimeout = 10 * time.Minute
+)
+
+// InitContainer 在主容器启动前按顺序运行, 必须以 0 退出, 与主容器共享存储卷
+type InitContainer struct {
+	Name  string
+	Image string
+	Cmd   []string
+	Env   []string
+	// 等待容器退出的最长秒数, 超时后强制移除容器, 为空时为 10 分钟
+	TimeoutSeconds *int
+}
+
+// Hook 在容器中执行命令或者向容器发送 HTTP GET 请求, 两者只需设置一个
+type Hook struct {
+	Exec    []string
+	HTTPGet *HTTPGetAction
+}
+
+type HTTPGetAction struct {
+	Path string
+	Port int
+}
+
+// RunInit 运行初始化容器直到退出或超时, 返回退出码, 容器运行结束后移除
+func (d *Docker) RunInit(ic InitContainer) (int64, error) {
+	ctx := context.Background()
+	timeout := initTimeout
+	if ic.TimeoutSeconds != nil {
+		timeout = time.Duration(*ic.TimeoutSeconds) * time.Second
+	}
+	start := time.Now()
+	reader, err := d.Client.ImagePull(ctx, ic.Image, image.PullOptions{})
+	if err != nil {
+		observe("image_pull", start, err)
+		logger.Error("拉取镜像失败", "image", ic.Image, "error", err)
+		return -1, err
+	}
+	_, _ = io.Copy(os.Stdout, reader)
+	observe("image_pull", start, nil)
+
+	cc := container.Config{
+		Image:  ic.Image,
+		Cmd:    ic.Cmd,
+		Env:    ic.Env,
+		Labels: d.Config.Labels,
+	}
+	hc := container.HostConfig{}
+	for _, m := range d.Config.Mounts {
+		hc.Mounts = append(hc.Mounts, mount.Mount{Type: mount.TypeVolume, Source: m.Volume, Target: m.Path})
+	}
+
+	name := fmt.Sprintf("%s-init-%s", d.Config.Name, ic.Name)
+	start = time.Now()
+	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, name)
+	observe("container_create", start, err)
+	if err != nil {
+		logger.Error("创建初始化容器失败", "image", ic.Image, "error", err)
+		return -1, err
+	}
+	defer func() {
+		// 超时时容器仍在运行, 强制移除
+		_ = d.Client.ContainerRemove(ctx, resp.ID, container.RemoveOptions{Force: true})
+	}()
+
+	start = time.Now()
+	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	observe("container_start", start, err)
+	if err != nil {
+		logger.Error("启动初始化容器失败", "container_id", resp.ID, "error", err)
+		return -1, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	statusCh, errCh := d.Client.ContainerWait(waitCtx, resp.ID, container.WaitConditionNotRunning)
+	select {
+	case err := <-errCh:
+		if waitCtx.Err() == context.DeadlineExceeded {
+			return -1, fmt.Errorf("初始化容器 %s 超过 %v 未退出", ic.Name, timeout)
+		}
+		return -1, err
+	case status := <-statusCh:
+		return status.StatusCode, nil
+	}
+}
+
+// RunHook 对容器 id 执行钩子, 命令退出码非 0 或者 HTTP 响应状态码不是 2xx 时返回错误
+func (d *Docker) RunHook(id string, h *Hook) error {
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	if len(h.Exec) > 0 {
+		return d.exec(ctx, id, h.Exec)
+	}
+	if h.HTTPGet != nil {
+		return d.httpGet(ctx, id, h.HTTPGet)
+	}
+	return nil
+}
+
+func (d *Docker) exec(ctx context.Context, id string, cmd []string) error {
+	start := time.Now()
+	created, err := d.Client.ContainerExecCreate(ctx, id, container.ExecOptions{
+		Cmd:          cmd,
+		AttachStdout: true,
+		AttachStderr: true,
+	})
+	observe("exec_create", start, err)
+	if err != nil {
+		return err
+	}
+
+	attach, err := d.Client.ContainerExecAttach(ctx, created.ID, container.ExecAttachOptions{})
+	if err != nil {
+		return err
+	}
+	defer attach.Close()
+	// 读取输出直到命令结束
+	_, _ = io.Copy(io.Discard, attach.Reader)
+
+	inspect, err := d.Client.ContainerExecInspect(ctx, created.ID)
+	if err != nil {
+		return err
+	}
+	if inspect.ExitCode != 0 {
+		return fmt.Errorf("命令 %v 退出码 %d", cmd, inspect.ExitCode)
+	}
+	return nil
+}
+
+func (d *Docker) httpGet(ctx context.Context, id string, action *HTTPGetAction) error {
+	resp := d.Inspect(id)
+	if resp.Error != nil {
+		return resp.Error
+	}
+	host := "localhost"
+	if ip := resp.Container.NetworkSettings.IPAddress; ip != "" {
+		host = ip
+	}
+
+	url := fmt.Sprintf("http://%s:%d%s", host, action.Port, action.Path)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	r, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer r.Body.Close()
+	if r.StatusCode < 200 || r.StatusCode >= 300 {
+		return fmt.Errorf("请求 %s 响应状态码 %d", url, r.StatusCode)
+	}
+	return nil
+}
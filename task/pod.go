@@ -0,0 +1,103 @@
+package task
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// Pod 一组始终调度到同一节点的任务, 成员共享第一个成员的网络命名空间和 Pod 声明的存储卷,
+// 作为整体启动, 停止和重启
+type Pod struct {
+	ID          uuid.UUID
+	Name        string
+	State       State
+	Node        string
+	Labels      map[string]string
+	Tolerations []Toleration
+	// Pod 声明的存储卷名称, 成员通过 Mounts 挂载
+	Volumes []string
+	// 成员任务模板, 每次启动时据此创建新的任务
+	Tasks []Task
+	// 当前运行的成员任务 ID, 与 Tasks 一一对应
+	TaskIDs      []uuid.UUID
+	RestartCount int
+	// Pod 结束后存储卷是否已从节点上删除
+	VolumesRemoved bool
+}
+
+type Mount struct {
+	Volume string
+	Path   string
+}
+
+// NetworkModeTask 网络模式前缀, 值为 task:<任务ID> 时共享该任务容器的网络命名空间
+const NetworkModeTask = "task:"
+
+// VolumeName 返回 Pod 存储卷对应的 docker 卷名称
+func (p *Pod) VolumeName(volume string) string {
+	return fmt.Sprintf("%s-%s", p.ID, volume)
+}
+
+// Validate 检查成员挂载的存储卷都已在 Pod 中声明
+func (p *Pod) Validate() error {
+	volumes := make(map[string]bool, len(p.Volumes))
+	for _, v := range p.Volumes {
+		volumes[v] = true
+	}
+	for _, t := range p.Tasks {
+		for _, m := range t.Mounts {
+			if !volumes[m.Volume] {
+				return fmt.Errorf("成员 %s 挂载的存储卷 %s 未在 Pod 中声明", t.Name, m.Volume)
+			}
+			if m.Path == "" {
+				return fmt.Errorf("成员 %s 挂载存储卷 %s 没有指定路径", t.Name, m.Volume)
+			}
+		}
+	}
+	return nil
+}
+
+// NewMembers 根据成员模板创建本次启动的成员任务, 容器名称带上重启次数以免与上次启动的容器冲突
+func (p *Pod) NewMembers() []Task {
+	members := make([]Task, len(p.Tasks))
+	for i, tmpl := range p.Tasks {
+		t := tmpl
+		t.ID = uuid.New()
+		t.Name = fmt.Sprintf("%s-%s-%d", p.Name, tmpl.Name, p.RestartCount)
+		t.State = Pending
+		t.Transitions = nil
+		t.PodID = p.ID
+		if i > 0 {
+			t.NetworkMode = NetworkModeTask + members[0].ID.String()
+			// 共享网络命名空间的容器不能发布端口
+			t.ExposedPorts = nil
+		}
+		t.Mounts = nil
+		for _, m := range tmpl.Mounts {
+			t.Mounts = append(t.Mounts, Mount{Volume: p.VolumeName(m.Volume), Path: m.Path})
+		}
+		members[i] = t
+	}
+	return members
+}
+
+// ResourceTask 返回代表整个 Pod 资源请求和调度约束的任务, 用于为 Pod 选择节点
+func (p *Pod) ResourceTask() Task {
+	t := Task{
+		ID:          p.ID,
+		Name:        p.Name,
+		Labels:      p.Labels,
+		Tolerations: p.Tolerations,
+	}
+	for _, m := range p.Tasks {
+		t.Cpu += m.Cpu
+		t.Memory += m.Memory
+		t.Disk += m.Disk
+		if m.Priority > t.Priority {
+			t.Priority = m.Priority
+		}
+		t.AntiAffinity = append(t.AntiAffinity, m.AntiAffinity...)
+		t.TopologySpread = append(t.TopologySpread, m.TopologySpread...)
+	}
+	return t
+}
@@ -0,0 +1,158 @@
+package task
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 标签选择器的运算符
+const (
+	SelectorEquals       = "="
+	SelectorNotEquals    = "!="
+	SelectorIn           = "in"
+	SelectorNotIn        = "notin"
+	SelectorExists       = "exists"
+	SelectorDoesNotExist = "!"
+)
+
+// Requirement 标签选择器中的一个条件
+type Requirement struct {
+	Key      string
+	Operator string
+	Values   []string
+}
+
+// Selector 标签选择器, 所有条件都满足时匹配, 没有条件时匹配所有对象。
+// 写法与 kubectl 相同, 条件以逗号分隔: app=web, env!=prod, tier in (a,b), tier notin (c), canary, !canary
+type Selector []Requirement
+
+var (
+	setRequirement = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+	labelKey       = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9._/-]*[A-Za-z0-9])?$`)
+)
+
+func ParseSelector(s string) (Selector, error) {
+	var selector Selector
+	for _, term := range splitTerms(s) {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			continue
+		}
+		r, err := parseRequirement(term)
+		if err != nil {
+			return nil, err
+		}
+		selector = append(selector, r)
+	}
+	return selector, nil
+}
+
+// splitTerms 按括号外的逗号分隔条件
+func splitTerms(s string) []string {
+	var terms []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				terms = append(terms, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(terms, s[start:])
+}
+
+func parseRequirement(term string) (Requirement, error) {
+	var r Requirement
+	switch {
+	case setRequirement.MatchString(term):
+		m := setRequirement.FindStringSubmatch(term)
+		r = Requirement{Key: m[1], Operator: m[2]}
+		for _, v := range strings.Split(m[3], ",") {
+			if v = strings.TrimSpace(v); v != "" {
+				r.Values = append(r.Values, v)
+			}
+		}
+		if len(r.Values) == 0 {
+			return r, fmt.Errorf("无效的标签选择器 %s: 没有指定值", term)
+		}
+	case strings.Contains(term, "!="):
+		k, v, _ := strings.Cut(term, "!=")
+		r = Requirement{Key: strings.TrimSpace(k), Operator: SelectorNotEquals, Values: []string{strings.TrimSpace(v)}}
+	case strings.Contains(term, "="):
+		k, v, _ := strings.Cut(term, "=")
+		v = strings.TrimPrefix(v, "=")
+		r = Requirement{Key: strings.TrimSpace(k), Operator: SelectorEquals, Values: []string{strings.TrimSpace(v)}}
+	case strings.HasPrefix(term, "!"):
+		r = Requirement{Key: strings.TrimSpace(term[1:]), Operator: SelectorDoesNotExist}
+	default:
+		r = Requirement{Key: term, Operator: SelectorExists}
+	}
+	if !labelKey.MatchString(r.Key) {
+		return r, fmt.Errorf("无效的标签选择器 %s: 无效的标签 %q", term, r.Key)
+	}
+	return r, nil
+}
+
+func (r Requirement) Matches(labels map[string]string) bool {
+	v, ok := labels[r.Key]
+	switch r.Operator {
+	case SelectorEquals:
+		return ok && v == r.Values[0]
+	case SelectorNotEquals:
+		return !ok || v != r.Values[0]
+	case SelectorIn:
+		return ok && containsString(r.Values, v)
+	case SelectorNotIn:
+		return !ok || !containsString(r.Values, v)
+	case SelectorExists:
+		return ok
+	case SelectorDoesNotExist:
+		return !ok
+	}
+	return false
+}
+
+func (r Requirement) String() string {
+	switch r.Operator {
+	case SelectorEquals, SelectorNotEquals:
+		return r.Key + r.Operator + r.Values[0]
+	case SelectorIn, SelectorNotIn:
+		return fmt.Sprintf("%s %s (%s)", r.Key, r.Operator, strings.Join(r.Values, ","))
+	case SelectorDoesNotExist:
+		return "!" + r.Key
+	}
+	return r.Key
+}
+
+func (s Selector) Matches(labels map[string]string) bool {
+	for _, r := range s {
+		if !r.Matches(labels) {
+			return false
+		}
+	}
+	return true
+}
+
+func (s Selector) String() string {
+	var terms []string
+	for _, r := range s {
+		terms = append(terms, r.String())
+	}
+	return strings.Join(terms, ",")
+}
+
+func containsString(values []string, v string) bool {
+	for _, s := range values {
+		if s == v {
+			return true
+		}
+	}
+	return false
+}
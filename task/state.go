@@ -1,11 +1,96 @@
 package task
 
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+type State int
+
+const (
+	Pending State = iota
+	Scheduled
+	Running
+	Completed
+	Failed
+	Stopping
+	Pulling
+	Starting
+	Restarting
+	Lost
+	Unschedulable
+)
+
+var stateNames = []string{
+	"Pending", "Scheduled", "Running", "Completed", "Failed", "Stopping",
+	"Pulling", "Starting", "Restarting", "Lost", "Unschedulable",
+}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+	return stateNames[s]
+}
+
+func ParseState(name string) (State, error) {
+	for i, n := range stateNames {
+		if n == name {
+			return State(i), nil
+		}
+	}
+	return Pending, fmt.Errorf("未知的任务状态: %s", name)
+}
+
+func (s State) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// UnmarshalJSON 同时兼容状态名称和旧版本的整数表示
+func (s *State) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		state, err := ParseState(name)
+		if err != nil {
+			return err
+		}
+		*s = state
+		return nil
+	}
+
+	var i int
+	if err := json.Unmarshal(data, &i); err != nil {
+		return fmt.Errorf("无效的任务状态: %s", data)
+	}
+	*s = State(i)
+	return nil
+}
+
+// stateTransitions manager 和 worker 共用的任务状态转换表
 var stateTransitions = map[State][]State{
-	Pending:   {Scheduled},
-	Scheduled: {Scheduled, Running, Failed},
-	Running:   {Running, Completed, Failed},
-	Completed: {},
-	Failed:    {},
+	Pending:       {Scheduled, Unschedulable, Completed},
+	Unschedulable: {Unschedulable, Pending, Scheduled, Completed},
+	Scheduled:     {Scheduled, Pulling, Starting, Running, Stopping, Failed, Lost},
+	Pulling:       {Starting, Stopping, Completed, Failed, Lost},
+	Starting:      {Running, Stopping, Completed, Failed, Lost},
+	Running:       {Running, Stopping, Restarting, Completed, Failed, Lost},
+	Stopping:      {Stopping, Completed, Failed, Lost},
+	Restarting:    {Scheduled, Pulling, Failed},
+	Lost:          {Lost, Running, Stopping, Restarting, Completed, Failed},
+	Completed:     {},
+	Failed:        {Restarting, Scheduled},
+}
+
+// 任务运行超过 ActiveDeadlineSeconds
+const ReasonDeadlineExceeded = "DeadlineExceeded"
+
+// Transition 任务的一次状态转换记录
+type Transition struct {
+	From   State
+	To     State
+	Time   time.Time
+	Reason string
 }
 
 func Contains(states []State, state State) bool {
@@ -20,3 +105,43 @@ func Contains(states []State, state State) bool {
 func ValidateTransitions(src State, dst State) bool {
 	return Contains(stateTransitions[src], dst)
 }
+
+// TransitionTo 按状态转换表将任务转换到 dst 状态并记录转换历史, 状态不变时只更新原因
+func (t *Task) TransitionTo(dst State, reason string) error {
+	if !ValidateTransitions(t.State, dst) {
+		return fmt.Errorf("任务 %s 状态转换无效, 原状态 %v, 目标状态 %v", t.ID, t.State, dst)
+	}
+	if reason != "" {
+		t.Reason = reason
+	}
+	if t.State == dst {
+		return nil
+	}
+	t.Transitions = append(t.Transitions, Transition{From: t.State, To: dst, Time: time.Now().UTC(), Reason: reason})
+	t.State = dst
+	return nil
+}
+
+// Equal 比较两条转换记录, 转换时间经过 JSON 编码后仍然相等
+func (tr Transition) Equal(other Transition) bool {
+	return tr.From == other.From && tr.To == other.To && tr.Reason == other.Reason && tr.Time.Equal(other.Time)
+}
+
+// DeadlineExceeded 运行中的任务是否超过了 ActiveDeadlineSeconds
+func (t *Task) DeadlineExceeded() bool {
+	if t.ActiveDeadlineSeconds == nil || t.StartTime.IsZero() {
+		return false
+	}
+	return time.Since(t.StartTime) > time.Duration(*t.ActiveDeadlineSeconds)*time.Second
+}
+
+// Expired 已结束的任务是否超过了 TTLSecondsAfterFinished
+func (t *Task) Expired() bool {
+	if t.TTLSecondsAfterFinished == nil || t.FinishTime.IsZero() {
+		return false
+	}
+	if t.State != Completed && t.State != Failed {
+		return false
+	}
+	return time.Since(t.FinishTime) > time.Duration(*t.TTLSecondsAfterFinished)*time.Second
+}
@@ -2,32 +2,23 @@ package task
 
 import (
 	"context"
+	"cube/logging"
+	"fmt"
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/mount"
 	"github.com/docker/docker/client"
 	"github.com/docker/docker/pkg/stdcopy"
 	"github.com/docker/go-connections/nat"
 	"github.com/google/uuid"
 	"io"
-	"log"
 	"os"
 	"time"
 )
 
-type State int
-
-const (
-	Pending State = iota
-	Scheduled
-	Running
-	Completed
-	Failed
-)
-
-func (s State) String() []string {
-	return []string{"Pending", "Scheduled", "Running", "Completed", "Failed"}
-}
+var logger = logging.Component("task")
 
 type Task struct {
 	ID           uuid.UUID
@@ -41,6 +32,46 @@ type Task struct {
 	ExposedPorts nat.PortSet
 	PortBindings map[string]string
 	HostPorts    nat.PortMap
+	// 任务被调度到的节点
+	Node string
+	// 标签用于按标签选择器查询, 停止和 watch 任务, 并设置为容器标签; 注解只记录附加信息
+	Labels      map[string]string
+	Annotations map[string]string
+	// 调度约束
+	AntiAffinity   []AntiAffinityTerm
+	TopologySpread []TopologySpreadConstraint
+	Tolerations    []Toleration
+	// 优先级越高越先调度, 开启抢占时可以驱逐低优先级任务
+	Priority int
+	// 最近一次调度失败时各节点未通过过滤的原因
+	SchedulingErrors map[string]string
+	// 所属 Pod, 以及 Pod 成员共享的网络和存储卷
+	PodID       uuid.UUID
+	NetworkMode string
+	Mounts      []Mount
+	// 所属工作流, 工作流步骤失败后由工作流按步骤重试
+	WorkflowID uuid.UUID
+	// 所属定时任务
+	CronTaskID uuid.UUID
+	// 主容器启动前按顺序运行的初始化容器, 以及主容器启动后和停止前执行的钩子
+	InitContainers []InitContainer
+	PostStart      *Hook
+	PreStop        *Hook
+	// 最近一次状态变化的原因, 以及状态转换历史
+	Reason      string
+	Transitions []Transition
+	// manager 每次向 worker 下发变更 (调度, 重启, 停止) 时加 1, worker 上报任务时原样带回,
+	// manager 据此忽略 worker 处理最新变更之前上报的状态
+	Generation int64
+	// 停止容器时发送的信号和等待容器退出的秒数, 为空时使用 docker 默认值
+	StopSignal  string
+	StopTimeout *int
+	// 停止后的容器是否已被移除
+	ContainerRemoved bool
+	// 任务启动后允许运行的最长秒数, 超过后停止任务并标记为失败, 为空时不限制
+	ActiveDeadlineSeconds *int
+	// 任务结束后保留任务记录的秒数, 超过后 manager 删除任务记录, 任务事件和保留的容器, 为空时一直保留
+	TTLSecondsAfterFinished *int
 	// 任务异常策略
 	RestartPolicy string
 	Healthcheck   string
@@ -54,6 +85,8 @@ type Event struct {
 	State     State
 	Timestamp time.Time
 	Task      Task
+	// W3C trace 上下文 (traceparent 等), 使任务经过 manager 和 worker 的队列后仍属于同一个 trace
+	TraceContext map[string]string `json:",omitempty"`
 }
 
 type Config struct {
@@ -69,9 +102,27 @@ type Config struct {
 	Disk          int64
 	Env           []string
 	RestartPolicy string
+	NetworkMode   string
+	Mounts        []Mount
+	StopSignal    string
+	StopTimeout   *int
+	Labels        map[string]string
 }
 
+// 容器上记录所属任务和 worker 的标签, 在用户标签之后设置, 用户标签不能覆盖
+const (
+	LabelTaskID   = "cube.task.id"
+	LabelTaskName = "cube.task.name"
+	LabelWorker   = "cube.worker"
+)
+
 func NewConfig(t *Task) *Config {
+	labels := make(map[string]string, len(t.Labels)+2)
+	for k, v := range t.Labels {
+		labels[k] = v
+	}
+	labels[LabelTaskID] = t.ID.String()
+	labels[LabelTaskName] = t.Name
 	return &Config{
 		Name:          t.Name,
 		Image:         t.Image,
@@ -80,6 +131,11 @@ func NewConfig(t *Task) *Config {
 		Disk:          t.Disk,
 		ExposedPorts:  t.ExposedPorts,
 		RestartPolicy: t.RestartPolicy,
+		NetworkMode:   t.NetworkMode,
+		Mounts:        t.Mounts,
+		StopSignal:    t.StopSignal,
+		StopTimeout:   t.StopTimeout,
+		Labels:        labels,
 	}
 }
 
@@ -108,19 +164,35 @@ type DockerInspectResponse struct {
 	Container *types.ContainerJSON
 }
 
-func (d *Docker) Run() DockerResult {
+// ObserveDockerCall 每次调用 docker API 后调用, 参数为操作名称, 耗时和错误, 由 worker 设置用于记录指标
+var ObserveDockerCall = func(operation string, duration time.Duration, err error) {}
+
+func observe(operation string, start time.Time, err error) {
+	ObserveDockerCall(operation, time.Since(start), err)
+}
+
+// Pull 拉取任务镜像, 需要在 Run 之前调用
+func (d *Docker) Pull() DockerResult {
 	ctx := context.Background()
+	start := time.Now()
 	reader, err := d.Client.ImagePull(
 		ctx,
 		d.Config.Image,
 		image.PullOptions{},
 	)
 	if err != nil {
-		log.Printf("拉取镜像 %s, 错误: %v", d.Config.Image, err)
+		observe("image_pull", start, err)
+		logger.Error("拉取镜像失败", "image", d.Config.Image, "error", err)
 		return DockerResult{Error: err}
 	}
 	_, _ = io.Copy(os.Stdout, reader)
+	observe("image_pull", start, nil)
+	return DockerResult{Action: "pull", Result: "success"}
+}
 
+// Run 使用已拉取的镜像创建并启动容器
+func (d *Docker) Run() DockerResult {
+	ctx := context.Background()
 	rp := container.RestartPolicy{
 		Name: container.RestartPolicyMode(d.Config.RestartPolicy),
 	}
@@ -134,6 +206,7 @@ func (d *Docker) Run() DockerResult {
 		Tty:          false,
 		Env:          d.Config.Env,
 		ExposedPorts: d.Config.ExposedPorts,
+		Labels:       d.Config.Labels,
 	}
 
 	hc := container.HostConfig{
@@ -141,21 +214,36 @@ func (d *Docker) Run() DockerResult {
 		Resources:       r,
 		PublishAllPorts: true,
 	}
+	if d.Config.NetworkMode != "" {
+		hc.NetworkMode = container.NetworkMode(d.Config.NetworkMode)
+		// 共享其他容器网络命名空间时不能发布端口
+		if hc.NetworkMode.IsContainer() {
+			hc.PublishAllPorts = false
+			cc.ExposedPorts = nil
+		}
+	}
+	for _, m := range d.Config.Mounts {
+		hc.Mounts = append(hc.Mounts, mount.Mount{Type: mount.TypeVolume, Source: m.Volume, Target: m.Path})
+	}
 
+	start := time.Now()
 	resp, err := d.Client.ContainerCreate(ctx, &cc, &hc, nil, nil, d.Config.Name)
+	observe("container_create", start, err)
 	if err != nil {
-		log.Printf("创建容器失败，镜像名 %s, 错误: %v", d.Config.Image, err)
+		logger.Error("创建容器失败", "image", d.Config.Image, "error", err)
 		return DockerResult{Error: err}
 	}
+	start = time.Now()
 	err = d.Client.ContainerStart(ctx, resp.ID, container.StartOptions{})
+	observe("container_start", start, err)
 	if err != nil {
-		log.Printf("启动容器失败，容器 id: %s, 错误: %v", resp.ID, err)
+		logger.Error("启动容器失败", "container_id", resp.ID, "error", err)
 		return DockerResult{Error: err}
 	}
 
 	out, err := d.Client.ContainerLogs(ctx, resp.ID, container.LogsOptions{ShowStdout: true, ShowStderr: true})
 	if err != nil {
-		log.Printf("获取日志失败，容器 id：%s, 错误: %v", resp.ID, err)
+		logger.Error("获取日志失败", "container_id", resp.ID, "error", err)
 		return DockerResult{Error: err}
 	}
 
@@ -163,28 +251,69 @@ func (d *Docker) Run() DockerResult {
 	return DockerResult{ContainerId: resp.ID, Action: "start", Result: "success"}
 }
 
+// Stop 发送停止信号, 等待容器在超时时间内退出, 超时后强制停止, 不移除容器
 func (d *Docker) Stop(id string) DockerResult {
 	ctx := context.Background()
-	err := d.Client.ContainerStop(ctx, id, container.StopOptions{})
+	start := time.Now()
+	err := d.Client.ContainerStop(ctx, id, container.StopOptions{
+		Signal:  d.Config.StopSignal,
+		Timeout: d.Config.StopTimeout,
+	})
+	observe("container_stop", start, err)
 	if err != nil {
-		log.Printf("停止容器失败，容器 id：%s，错误 %v", id, err)
+		logger.Error("停止容器失败", "container_id", id, "error", err)
 		return DockerResult{Error: err}
 	}
 
-	err = d.Client.ContainerRemove(ctx, id, container.RemoveOptions{})
+	return DockerResult{Action: "stop", Result: "success"}
+}
+
+func (d *Docker) Remove(id string) DockerResult {
+	ctx := context.Background()
+	start := time.Now()
+	err := d.Client.ContainerRemove(ctx, id, container.RemoveOptions{})
+	observe("container_remove", start, err)
 	if err != nil {
-		log.Printf("移除容器失败，容器 id：%s，错误 %v", id, err)
+		logger.Error("移除容器失败", "container_id", id, "error", err)
 		return DockerResult{Error: err}
 	}
 
-	return DockerResult{Action: "stop", Result: "success"}
+	return DockerResult{Action: "remove", Result: "success"}
+}
+
+// ListContainers 返回带有全部指定标签的容器, 包括已经退出的容器
+func (d *Docker) ListContainers(labels map[string]string) ([]types.Container, error) {
+	ctx := context.Background()
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", fmt.Sprintf("%s=%s", k, v))
+	}
+	start := time.Now()
+	containers, err := d.Client.ContainerList(ctx, container.ListOptions{All: true, Filters: args})
+	observe("container_list", start, err)
+	return containers, err
+}
+
+// RemoveVolume 删除 docker 卷, 卷不存在时不返回错误
+func (d *Docker) RemoveVolume(name string) error {
+	ctx := context.Background()
+	start := time.Now()
+	err := d.Client.VolumeRemove(ctx, name, false)
+	observe("volume_remove", start, err)
+	if err != nil && !client.IsErrNotFound(err) {
+		logger.Error("删除存储卷失败", "volume", name, "error", err)
+		return err
+	}
+	return nil
 }
 
 func (d *Docker) Inspect(id string) DockerInspectResponse {
 	ctx := context.Background()
+	start := time.Now()
 	resp, err := d.Client.ContainerInspect(ctx, id)
+	observe("container_inspect", start, err)
 	if err != nil {
-		log.Printf("检视容器错误: %s\n", err)
+		logger.Warn("检视容器错误", "container_id", id, "error", err)
 		return DockerInspectResponse{Error: err}
 	}
 
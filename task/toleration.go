@@ -0,0 +1,24 @@
+package task
+
+const (
+	TolerationOpEqual  = "Equal"
+	TolerationOpExists = "Exists"
+)
+
+// Toleration 允许任务调度到带有匹配污点的节点, Effect 为空时匹配所有效果
+type Toleration struct {
+	Key      string
+	Operator string
+	Value    string
+	Effect   string
+}
+
+func (tl Toleration) Tolerates(key string, value string, effect string) bool {
+	if tl.Effect != "" && tl.Effect != effect {
+		return false
+	}
+	if tl.Operator == TolerationOpExists {
+		return tl.Key == "" || tl.Key == key
+	}
+	return tl.Key == key && tl.Value == value
+}
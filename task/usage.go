@@ -0,0 +1,77 @@
+package task
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/docker/docker/api/types/container"
+	"strings"
+	"time"
+)
+
+// Usage 任务容器的一次资源使用量采样
+type Usage struct {
+	Time time.Time
+	// 使用的 CPU 核数, 由相邻两次采样计算
+	Cpu float64
+	// 使用的内存字节数, 不含页缓存, 以及容器的内存上限
+	Memory      int64
+	MemoryLimit int64
+	// 容器启动以来累计的网络收发字节数和块设备读写字节数
+	NetworkRx  uint64
+	NetworkTx  uint64
+	BlockRead  uint64
+	BlockWrite uint64
+
+	cpuTotal uint64
+}
+
+// Usage 采集容器 id 的资源使用量, prev 为上一次采样, 为空时 CPU 使用量为 0
+func (d *Docker) Usage(id string, prev *Usage) (Usage, error) {
+	start := time.Now()
+	resp, err := d.Client.ContainerStatsOneShot(context.Background(), id)
+	observe("container_stats", start, err)
+	if err != nil {
+		return Usage{}, err
+	}
+	defer resp.Body.Close()
+
+	var s container.StatsResponse
+	if err := json.NewDecoder(resp.Body).Decode(&s); err != nil {
+		return Usage{}, err
+	}
+
+	u := Usage{
+		Time:        s.Read,
+		Memory:      memoryUsage(s.MemoryStats),
+		MemoryLimit: int64(s.MemoryStats.Limit),
+		cpuTotal:    s.CPUStats.CPUUsage.TotalUsage,
+	}
+	for _, n := range s.Networks {
+		u.NetworkRx += n.RxBytes
+		u.NetworkTx += n.TxBytes
+	}
+	for _, b := range s.BlkioStats.IoServiceBytesRecursive {
+		switch strings.ToLower(b.Op) {
+		case "read":
+			u.BlockRead += b.Value
+		case "write":
+			u.BlockWrite += b.Value
+		}
+	}
+	if prev != nil && u.cpuTotal >= prev.cpuTotal && u.Time.After(prev.Time) {
+		u.Cpu = float64(u.cpuTotal-prev.cpuTotal) / float64(u.Time.Sub(prev.Time).Nanoseconds())
+	}
+	return u, nil
+}
+
+// memoryUsage 与 docker stats 一致, 从使用量中减去可回收的页缓存
+func memoryUsage(m container.MemoryStats) int64 {
+	cache := m.Stats["inactive_file"]
+	if v, ok := m.Stats["total_inactive_file"]; ok {
+		cache = v
+	}
+	if m.Usage < cache {
+		return int64(m.Usage)
+	}
+	return int64(m.Usage - cache)
+}
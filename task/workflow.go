@@ -0,0 +1,97 @@
+package task
+
+import (
+	"fmt"
+	"github.com/google/uuid"
+)
+
+// 上游步骤失败, 步骤不会运行
+const ReasonUpstreamFailed = "UpstreamFailed"
+
+// Workflow 由步骤及其依赖组成的有向无环图, 步骤在所有上游步骤完成后才会运行
+type Workflow struct {
+	ID    uuid.UUID
+	Name  string
+	State State
+	Steps []WorkflowStep
+}
+
+type WorkflowStep struct {
+	Name      string
+	Task      Task
+	DependsOn []string
+	// 步骤失败后的最大重试次数, 每次重试以新的任务运行
+	Retries int
+	State   State
+	Reason  string
+	// 每次运行对应的任务 id, 最后一个为当前运行
+	TaskIDs []uuid.UUID
+}
+
+// Validate 检查步骤名称唯一, 依赖的步骤存在且依赖关系无环
+func (wf *Workflow) Validate() error {
+	if len(wf.Steps) == 0 {
+		return fmt.Errorf("工作流没有步骤")
+	}
+	index := make(map[string]int, len(wf.Steps))
+	for i, s := range wf.Steps {
+		if s.Name == "" {
+			return fmt.Errorf("第 %d 个步骤没有名称", i+1)
+		}
+		if _, ok := index[s.Name]; ok {
+			return fmt.Errorf("步骤名称重复: %s", s.Name)
+		}
+		index[s.Name] = i
+	}
+	for _, s := range wf.Steps {
+		for _, dep := range s.DependsOn {
+			if _, ok := index[dep]; !ok {
+				return fmt.Errorf("步骤 %s 依赖的步骤 %s 不存在", s.Name, dep)
+			}
+		}
+	}
+
+	// 0 未访问, 1 访问中, 2 已完成
+	visit := make([]int, len(wf.Steps))
+	var dfs func(i int) error
+	dfs = func(i int) error {
+		switch visit[i] {
+		case 1:
+			return fmt.Errorf("步骤 %s 存在循环依赖", wf.Steps[i].Name)
+		case 2:
+			return nil
+		}
+		visit[i] = 1
+		for _, dep := range wf.Steps[i].DependsOn {
+			if err := dfs(index[dep]); err != nil {
+				return err
+			}
+		}
+		visit[i] = 2
+		return nil
+	}
+	for i := range wf.Steps {
+		if err := dfs(i); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Step 返回指定名称的步骤
+func (wf *Workflow) Step(name string) *WorkflowStep {
+	for i := range wf.Steps {
+		if wf.Steps[i].Name == name {
+			return &wf.Steps[i]
+		}
+	}
+	return nil
+}
+
+// Finished 步骤是否已经结束, 失败的步骤还有重试次数时不算结束
+func (s *WorkflowStep) Finished() bool {
+	if s.State == Completed {
+		return true
+	}
+	return s.State == Failed && (len(s.TaskIDs) == 0 || len(s.TaskIDs) > s.Retries)
+}
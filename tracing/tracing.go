@@ -0,0 +1,102 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.25.0"
+	"go.opentelemetry.io/otel/trace"
+	"net/http"
+	"os"
+)
+
+// Client 在请求头中传递 trace 上下文并为请求创建 span, manager 向 worker 发送请求时使用
+var Client = &http.Client{Transport: otelhttp.NewTransport(http.DefaultTransport)}
+
+// Setup 设置全局 TracerProvider 和 trace 上下文传递格式 (W3C traceparent)。
+// exporter 为 none 时不导出, otlp 时以 OTLP/HTTP 导出到 endpoint (如 localhost:4318),
+// file 时以 JSON 格式追加写入文件 endpoint。返回的函数在退出前调用, 用于导出剩余的 span
+func Setup(service string, exporter string, endpoint string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
+	var opt sdktrace.TracerProviderOption
+	switch exporter {
+	case "", "none":
+		return func(context.Context) error { return nil }, nil
+	case "otlp":
+		exp, err := otlptracehttp.New(context.Background(), otlptracehttp.WithEndpoint(endpoint), otlptracehttp.WithInsecure())
+		if err != nil {
+			return nil, fmt.Errorf("创建 OTLP 导出器失败: %v", err)
+		}
+		opt = sdktrace.WithBatcher(exp)
+	case "file":
+		f, err := os.OpenFile(endpoint, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, fmt.Errorf("打开 trace 文件 %s 失败: %v", endpoint, err)
+		}
+		exp, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			return nil, fmt.Errorf("创建文件导出器失败: %v", err)
+		}
+		opt = sdktrace.WithSyncer(exp)
+	default:
+		return nil, fmt.Errorf("无效的 trace 导出方式: %s, 可选 none, otlp 或者 file", exporter)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service)))
+	if err != nil {
+		return nil, err
+	}
+	tp := sdktrace.NewTracerProvider(opt, sdktrace.WithResource(res))
+	otel.SetTracerProvider(tp)
+	return tp.Shutdown, nil
+}
+
+// Tracer 返回指定组件的 tracer, 调用 Setup 之前创建的 tracer 在 Setup 之后同样生效
+func Tracer(name string) trace.Tracer {
+	return otel.Tracer("cube/" + name)
+}
+
+// Handler 为收到的请求创建 span, 并从请求头中恢复调用方的 trace 上下文。
+// 不带 trace 上下文的 GET 请求 (定期采集任务状态, 统计信息和指标) 不创建 span
+func Handler(h http.Handler, operation string) http.Handler {
+	return otelhttp.NewHandler(h, operation,
+		otelhttp.WithFilter(func(r *http.Request) bool {
+			return r.Method != http.MethodGet || r.Header.Get("traceparent") != ""
+		}),
+		otelhttp.WithSpanNameFormatter(func(operation string, r *http.Request) string {
+			return fmt.Sprintf("%s %s %s", operation, r.Method, r.URL.Path)
+		}),
+	)
+}
+
+// Inject 将 ctx 中的 trace 上下文写入 map, 用于保存在任务事件中跨队列传递
+func Inject(ctx context.Context) map[string]string {
+	carrier := propagation.MapCarrier{}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+	if len(carrier) == 0 {
+		return nil
+	}
+	return carrier
+}
+
+// Extract 从 Inject 生成的 map 中恢复 trace 上下文
+func Extract(ctx context.Context, carrier map[string]string) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, propagation.MapCarrier(carrier))
+}
+
+// RecordError 在 span 上记录错误并将状态设置为失败
+func RecordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
@@ -1,6 +1,7 @@
 package worker
 
 import (
+	"cube/tracing"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"net/http"
@@ -25,14 +26,18 @@ func (a *Api) initRouter() {
 		r.Get("/", a.GetTaskHandler)
 		r.Route("/{taskID}", func(r chi.Router) {
 			r.Delete("/", a.StopTaskHandler)
+			r.Delete("/purge", a.PurgeTaskHandler)
+			r.Get("/stats", a.GetTaskStatsHandler)
 		})
 	})
+	a.Router.Delete("/volumes/{name}", a.RemoveVolumeHandler)
 	a.Router.Route("/stats", func(r chi.Router) {
 		r.Get("/", a.GetStatsHandler)
 	})
+	a.Router.Get("/metrics", a.MetricsHandler)
 }
 
 func (a *Api) Start() {
 	a.initRouter()
-	_ = http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), a.Router)
+	_ = http.ListenAndServe(fmt.Sprintf("%s:%d", a.Address, a.Port), tracing.Handler(a.Router, "worker"))
 }
@@ -2,12 +2,14 @@ package worker
 
 import (
 	"cube/task"
+	"cube/tracing"
 	"encoding/json"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
-	"log"
 	"net/http"
+	"strconv"
+	"time"
 )
 
 func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
@@ -18,7 +20,7 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 	err := d.Decode(&te)
 	if err != nil {
 		msg := fmt.Sprintf("json 解码失败: %v\n", err)
-		log.Printf(msg)
+		logger.Warn("json 解码失败", "error", err)
 		w.WriteHeader(400)
 		e := ErrResponse{
 			HTTPStatusCode: 400,
@@ -28,8 +30,9 @@ func (a *Api) StartTaskHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	a.Worker.AddTask(te.Task)
-	log.Printf("添加任务: %v\n", te.Task.ID)
+	te.TraceContext = tracing.Inject(r.Context())
+	a.Worker.AddTask(te)
+	logger.Info("添加任务", "task_id", te.Task.ID, "event_id", te.ID)
 	w.WriteHeader(201)
 	_ = json.NewEncoder(w).Encode(te.Task)
 }
@@ -43,27 +46,89 @@ func (a *Api) GetTaskHandler(w http.ResponseWriter, r *http.Request) {
 func (a *Api) StopTaskHandler(w http.ResponseWriter, r *http.Request) {
 	taskID := chi.URLParam(r, "taskID")
 	if taskID == "" {
-		log.Printf("未传递 id 参数\n")
+		logger.Warn("未传递 id 参数")
 		w.WriteHeader(400)
+		return
 	}
 
 	tID, _ := uuid.Parse(taskID)
 	taskToStop, err := a.Worker.Db.Get(tID.String())
 	if err != nil {
-		log.Printf("任务 id: %v\n 未找到", tID)
+		logger.Warn("任务未找到", "task_id", tID)
 		w.WriteHeader(404)
+		return
 	}
-	// 复制原任务作为期望状态任务
+	// 复制原任务作为期望状态任务, 带上 manager 下发的 Generation
 	taskCopy := *taskToStop.(*task.Task)
 	taskCopy.State = task.Completed
-	a.Worker.AddTask(taskCopy)
+	if g := r.URL.Query().Get("generation"); g != "" {
+		taskCopy.Generation, _ = strconv.ParseInt(g, 10, 64)
+	}
+	a.Worker.AddTask(task.Event{
+		ID:           uuid.New(),
+		State:        task.Completed,
+		Timestamp:    time.Now(),
+		Task:         taskCopy,
+		TraceContext: tracing.Inject(r.Context()),
+	})
+
+	logger.Info("添加停止任务", "task_id", taskCopy.ID, "container_id", taskCopy.ContainerID)
+	w.WriteHeader(204)
+}
+
+func (a *Api) PurgeTaskHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	if _, err := a.Worker.Db.Get(taskID); err != nil {
+		logger.Warn("任务未找到", "task_id", taskID)
+		w.WriteHeader(404)
+		return
+	}
+	if err := a.Worker.PurgeTask(taskID); err != nil {
+		logger.Warn("删除任务失败", "task_id", taskID, "error", err)
+		w.WriteHeader(409)
+		_ = json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: err.Error()})
+		return
+	}
+	w.WriteHeader(204)
+}
 
-	log.Printf("添加任务: %v，停止容器: %v\n", taskCopy.ID, taskCopy.ContainerID)
+func (a *Api) RemoveVolumeHandler(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+	if err := a.Worker.RemoveVolume(name); err != nil {
+		logger.Warn("删除存储卷失败", "volume", name, "error", err)
+		w.WriteHeader(409)
+		_ = json.NewEncoder(w).Encode(ErrResponse{HTTPStatusCode: 409, Message: err.Error()})
+		return
+	}
 	w.WriteHeader(204)
 }
 
+func (a *Api) GetTaskStatsHandler(w http.ResponseWriter, r *http.Request) {
+	taskID := chi.URLParam(r, "taskID")
+	tID, err := uuid.Parse(taskID)
+	if err != nil {
+		logger.Warn("无效的任务 id", "task_id", taskID)
+		w.WriteHeader(400)
+		return
+	}
+	if _, err := a.Worker.Db.Get(tID.String()); err != nil {
+		logger.Warn("任务未找到", "task_id", tID)
+		w.WriteHeader(404)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(200)
+	_ = json.NewEncoder(w).Encode(a.Worker.TaskUsage(tID))
+}
+
 func (a *Api) GetStatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(200)
 	_ = json.NewEncoder(w).Encode(a.Worker.Stats)
 }
+
+func (a *Api) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	a.Worker.collectMetrics()
+	metricsHandler.ServeHTTP(w, r)
+}
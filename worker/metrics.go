@@ -0,0 +1,80 @@
+package worker
+
+import (
+	"cube/task"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"time"
+)
+
+var (
+	registry       = prometheus.NewRegistry()
+	factory        = promauto.With(registry)
+	metricsHandler = promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+
+	queueDepth   = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_queue_depth", Help: "worker 队列中等待处理的任务数"})
+	tasksByState = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_worker_tasks", Help: "worker 上各状态的任务数"}, []string{"state"})
+
+	// 耗时直方图的桶上限, 单位为秒
+	durationBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+	dockerDuration  = factory.NewHistogramVec(prometheus.HistogramOpts{Name: "cube_worker_docker_api_duration_seconds",
+		Help: "调用 docker API 的耗时", Buckets: durationBuckets}, []string{"operation"})
+	dockerErrors = factory.NewCounterVec(prometheus.CounterOpts{Name: "cube_worker_docker_api_errors_total", Help: "调用 docker API 失败的次数"}, []string{"operation"})
+
+	cpuUsage        = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_cpu_usage_ratio", Help: "节点 CPU 使用率"})
+	cpuCores        = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_cpu_cores", Help: "节点 CPU 核数"})
+	memoryTotal     = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_memory_total_kilobytes", Help: "节点内存总量"})
+	memoryAvailable = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_memory_available_kilobytes", Help: "节点可用内存"})
+	diskTotal       = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_disk_total_bytes", Help: "节点磁盘总量"})
+	diskFree        = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_disk_free_bytes", Help: "节点磁盘剩余空间"})
+	load1           = factory.NewGauge(prometheus.GaugeOpts{Name: "cube_worker_load1", Help: "节点 1 分钟平均负载"})
+
+	taskCpuUsage    = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_task_cpu_usage_cores", Help: "任务使用的 CPU 核数"}, []string{"task", "name"})
+	taskMemoryUsage = factory.NewGaugeVec(prometheus.GaugeOpts{Name: "cube_task_memory_usage_bytes", Help: "任务使用的内存"}, []string{"task", "name"})
+)
+
+func init() {
+	task.ObserveDockerCall = func(operation string, duration time.Duration, err error) {
+		dockerDuration.WithLabelValues(operation).Observe(duration.Seconds())
+		if err != nil {
+			dockerErrors.WithLabelValues(operation).Inc()
+		}
+	}
+}
+
+// collectMetrics 在输出指标前更新队列长度, 任务状态以及最近一次采集的节点和任务资源使用量
+func (w *Worker) collectMetrics() {
+	queueDepth.Set(float64(w.Queue.Len()))
+
+	tasks := w.GetTasks()
+	tasksByState.Reset()
+	counts := make(map[task.State]int)
+	names := make(map[string]string)
+	for _, t := range tasks {
+		counts[t.State]++
+		names[t.ID.String()] = t.Name
+	}
+	for state, n := range counts {
+		tasksByState.WithLabelValues(state.String()).Set(float64(n))
+	}
+
+	s := w.Stats
+	if s == nil {
+		return
+	}
+	cpuUsage.Set(s.CpuUsage())
+	cpuCores.Set(float64(s.CpuCount))
+	memoryTotal.Set(float64(s.MemTotalKb()))
+	memoryAvailable.Set(float64(s.MemAvailableKb()))
+	diskTotal.Set(float64(s.DiskTotal()))
+	diskFree.Set(float64(s.DiskFree()))
+	load1.Set(s.LoadStats.Last1Min)
+
+	taskCpuUsage.Reset()
+	taskMemoryUsage.Reset()
+	for id, u := range s.TaskUsage {
+		taskCpuUsage.WithLabelValues(id, names[id]).Set(u.Cpu)
+		taskMemoryUsage.WithLabelValues(id, names[id]).Set(float64(u.Memory))
+	}
+}
@@ -1,8 +1,10 @@
 package worker
 
 import (
+	"cube/task"
 	"github.com/c9s/goprocinfo/linux"
-	"log"
+	"runtime"
+	"time"
 )
 
 type Stats struct {
@@ -11,6 +13,12 @@ type Stats struct {
 	CpuStats  *linux.CPUStat
 	LoadStats *linux.LoadAvg
 	TaskCount int
+	Labels    map[string]string
+	CpuCount  int
+	// 运行中任务的资源使用量, 键为任务 id
+	TaskUsage map[string]task.Usage
+	// 采集时间, manager 据此判断是否收到了新的采样
+	CollectedAt time.Time
 }
 
 func (s *Stats) MemTotalKb() uint64 {
@@ -59,13 +67,14 @@ func GetStats() *Stats {
 		DiskStats: GetDiskInfo(),
 		CpuStats:  GetCpuStats(),
 		LoadStats: GetLoadAvg(),
+		CpuCount:  runtime.NumCPU(),
 	}
 }
 
 func GetMemoryInfo() *linux.MemInfo {
 	memstats, err := linux.ReadMemInfo("/proc/meminfo")
 	if err != nil {
-		log.Printf("读取 /proc/meminfo 错误")
+		logger.Warn("读取 /proc/meminfo 错误", "error", err)
 		return &linux.MemInfo{}
 	}
 
@@ -75,7 +84,7 @@ func GetMemoryInfo() *linux.MemInfo {
 func GetDiskInfo() *linux.Disk {
 	diskstats, err := linux.ReadDisk("/")
 	if err != nil {
-		log.Printf("读取分区 / 错误")
+		logger.Warn("读取分区 / 错误", "error", err)
 		return &linux.Disk{}
 	}
 
@@ -85,7 +94,7 @@ func GetDiskInfo() *linux.Disk {
 func GetCpuStats() *linux.CPUStat {
 	stats, err := linux.ReadStat("/proc/stat")
 	if err != nil {
-		log.Printf("读取 /proc/stat 错误")
+		logger.Warn("读取 /proc/stat 错误", "error", err)
 		return &linux.CPUStat{}
 	}
 
@@ -95,7 +104,7 @@ func GetCpuStats() *linux.CPUStat {
 func GetLoadAvg() *linux.LoadAvg {
 	loadavg, err := linux.ReadLoadAvg("/proc/loadavg")
 	if err != nil {
-		log.Printf("读取 /proc/loadavg 错误")
+		logger.Warn("读取 /proc/loadavg 错误", "error", err)
 		return &linux.LoadAvg{}
 	}
 
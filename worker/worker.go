@@ -1,15 +1,34 @@
 package worker
 
 import (
+	"context"
+	"cube/logging"
 	"cube/store"
 	"cube/task"
+	"cube/tracing"
 	"errors"
 	"fmt"
 	"github.com/golang-collections/collections/queue"
-	"log"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"os"
+	"strings"
+	"sync"
 	"time"
 )
 
+// StatsInterval 采集节点统计信息的间隔, 不大于 manager 采集节点统计信息的间隔
+const StatsInterval = 5 * time.Second
+
+// 每个任务保留的资源使用量采样数, 按 StatsInterval 的采集间隔约为 10 分钟
+const usageHistorySize = 120
+
+var (
+	logger = logging.Component("worker")
+	tracer = tracing.Tracer("worker")
+)
+
 type Worker struct {
 	Name string
 	// 任务临时存放区域
@@ -18,12 +37,23 @@ type Worker struct {
 	Db        store.Store
 	Stats     *Stats
 	TaskCount int
+	// 节点标签, 用于拓扑分布等调度约束
+	Labels map[string]string
+	// 任务结束后保留容器的时间, 便于排查问题, 为 0 时立即移除
+	Retention time.Duration
+
+	// 运行中任务最近的资源使用量采样
+	usage   map[uuid.UUID][]task.Usage
+	usageMu sync.Mutex
 }
 
-func New(name string, taskDbType string) *Worker {
+func New(name string, taskDbType string, labels map[string]string, retention time.Duration) *Worker {
 	w := Worker{
-		Name:  name,
-		Queue: *queue.New(),
+		Name:      name,
+		Queue:     *queue.New(),
+		Labels:    labels,
+		Retention: retention,
+		usage:     make(map[uuid.UUID][]task.Usage),
 	}
 
 	var s store.Store
@@ -35,21 +65,22 @@ func New(name string, taskDbType string) *Worker {
 		filename := fmt.Sprintf("%s_tasks.db", name)
 		s, err = store.NewTaskStore(filename, 0600, "tasks")
 		if err != nil {
-			log.Fatalf("不能创建任务 store: %v", err)
+			logger.Error("不能创建任务 store", "error", err)
+			os.Exit(1)
 		}
 	}
 	w.Db = s
 	return &w
 }
 
-func (w *Worker) AddTask(t task.Task) {
-	w.Queue.Enqueue(t)
+func (w *Worker) AddTask(te task.Event) {
+	w.Queue.Enqueue(te)
 }
 
 func (w *Worker) GetTasks() []*task.Task {
 	taskList, err := w.Db.List()
 	if err != nil {
-		log.Printf("获取任务列表失败: %v\n", err)
+		logger.Error("获取任务列表失败", "error", err)
 		return nil
 	}
 
@@ -58,11 +89,55 @@ func (w *Worker) GetTasks() []*task.Task {
 
 func (w *Worker) CollectionStats() {
 	for {
-		log.Println("收集 stats")
-		w.Stats = GetStats()
-		w.Stats.TaskCount = w.TaskCount
-		time.Sleep(15 * time.Second)
+		logger.Debug("收集 stats")
+		stats := GetStats()
+		stats.TaskCount = w.TaskCount
+		stats.Labels = w.Labels
+		stats.TaskUsage = w.collectTaskUsage()
+		stats.CollectedAt = time.Now().UTC()
+		w.Stats = stats
+		time.Sleep(StatsInterval)
+	}
+}
+
+// collectTaskUsage 通过 docker stats 采集运行中任务的资源使用量, 每个任务保留最近 usageHistorySize 次采样,
+// CPU 使用量由与上一次采样的差值计算, 返回各任务最新的采样
+func (w *Worker) collectTaskUsage() map[string]task.Usage {
+	w.usageMu.Lock()
+	defer w.usageMu.Unlock()
+
+	current := make(map[uuid.UUID][]task.Usage)
+	result := make(map[string]task.Usage)
+	for _, t := range w.GetTasks() {
+		if t.State != task.Running || t.ContainerID == "" {
+			continue
+		}
+		history := w.usage[t.ID]
+		var prev *task.Usage
+		if len(history) > 0 {
+			prev = &history[len(history)-1]
+		}
+		u, err := task.NewDocker(task.NewConfig(t)).Usage(t.ContainerID, prev)
+		if err != nil {
+			logger.Warn("采集任务资源使用量失败", "task_id", t.ID, "error", err)
+			continue
+		}
+		history = append(history, u)
+		if len(history) > usageHistorySize {
+			history = history[len(history)-usageHistorySize:]
+		}
+		current[t.ID] = history
+		result[t.ID.String()] = u
 	}
+	w.usage = current
+	return result
+}
+
+// TaskUsage 返回任务最近的资源使用量采样, 按时间从早到晚排列
+func (w *Worker) TaskUsage(id uuid.UUID) []task.Usage {
+	w.usageMu.Lock()
+	defer w.usageMu.Unlock()
+	return append([]task.Usage(nil), w.usage[id]...)
 }
 
 func (w *Worker) RunTasks() {
@@ -70,30 +145,37 @@ func (w *Worker) RunTasks() {
 		if w.Queue.Len() != 0 {
 			result := w.runTask()
 			if result.Error != nil {
-				log.Printf("运行任务错误: %v", result.Error)
+				logger.Error("运行任务错误", "error", result.Error)
 			}
 		} else {
-			log.Printf("任务队列为空")
+			logger.Debug("任务队列为空")
 		}
-		log.Println("sleeping for 10 seconds")
 		time.Sleep(10 * time.Second)
 	}
 }
 
 func (w *Worker) runTask() task.DockerResult {
-	t := w.Queue.Dequeue()
-	if t == nil {
-		log.Println("当前队列没有任务")
+	e := w.Queue.Dequeue()
+	if e == nil {
+		logger.Debug("当前队列没有任务")
 		return task.DockerResult{Error: nil}
 	}
 
-	taskQueued := t.(task.Task)
+	te := e.(task.Event)
+	taskQueued := te.Task
+	ctx, span := tracer.Start(tracing.Extract(context.Background(), te.TraceContext), "worker.run_task", trace.WithAttributes(
+		attribute.String("task.id", taskQueued.ID.String()),
+		attribute.String("event.id", te.ID.String()),
+		attribute.String("task.state", taskQueued.State.String()),
+	))
+	defer span.End()
+
 	queuedTask, err := w.Db.Get(taskQueued.ID.String())
 	if err != nil {
 		err = w.Db.Put(taskQueued.ID.String(), &taskQueued)
 		if err != nil {
 			msg := fmt.Errorf("存储任务 %s, 错误: %v", taskQueued.ID.String(), err)
-			log.Println(msg)
+			logger.Error("存储任务失败", "task_id", taskQueued.ID, "error", err)
 			return task.DockerResult{Error: msg}
 		}
 		queuedTask = &taskQueued
@@ -101,30 +183,51 @@ func (w *Worker) runTask() task.DockerResult {
 	taskPersisted := *queuedTask.(*task.Task)
 
 	var result task.DockerResult
-	if task.ValidateTransitions(taskPersisted.State, taskQueued.State) {
-		switch taskQueued.State {
-		case task.Scheduled:
-			result = w.StartTask(taskQueued)
-		case task.Completed:
-			result = w.StopTask(taskQueued)
-		default:
-			result.Error = errors.New("状态转换异常")
+	switch taskQueued.State {
+	case task.Scheduled:
+		if taskPersisted.State == task.Scheduled {
+			result = w.StartTask(ctx, taskQueued)
+		} else if task.ValidateTransitions(taskPersisted.State, task.Restarting) {
+			result = w.restartTask(ctx, taskPersisted, taskQueued)
+		} else {
+			result.Error = fmt.Errorf("状态转换无效, 原状态 %v, 目标状态 %v", taskPersisted.State, task.Restarting)
 		}
-	} else {
-		err := fmt.Errorf("状态转换无效, 原状态 %v, 目标状态 %v", taskPersisted.State, taskQueued.State)
-		return task.DockerResult{Error: err}
+	case task.Completed:
+		if task.ValidateTransitions(taskPersisted.State, task.Stopping) {
+			taskPersisted.Generation = taskQueued.Generation
+			result = w.StopTask(taskPersisted)
+		} else {
+			result.Error = fmt.Errorf("状态转换无效, 原状态 %v, 目标状态 %v", taskPersisted.State, task.Stopping)
+		}
+	default:
+		result.Error = errors.New("状态转换异常")
 	}
+	tracing.RecordError(span, result.Error)
 
 	return result
 }
 
+// restartTask 移除任务原有的容器, 再按 manager 下发的任务重新启动
+func (w *Worker) restartTask(ctx context.Context, old task.Task, t task.Task) task.DockerResult {
+	if old.ContainerID != "" && !old.ContainerRemoved {
+		d := task.NewDocker(task.NewConfig(&old))
+		if old.State == task.Running {
+			d.Stop(old.ContainerID)
+		}
+		w.removeContainer(d, &old)
+	}
+	logger.Info("重启任务", "task_id", t.ID, "restart_count", t.RestartCount)
+	return w.StartTask(ctx, t)
+}
+
 func (w *Worker) UpdateTask() {
 	for {
 		for {
-			log.Println("从 docker 检测任务状态")
+			logger.Debug("从 docker 检测任务状态")
 			w.updateTasks()
-			log.Println("任务状态更新完成")
-			log.Println("sleeping for 15 seconds")
+			w.removeExpiredContainers()
+			w.removeOrphanedContainers()
+			logger.Debug("任务状态更新完成, 15 秒后再次检测")
 			time.Sleep(15 * time.Second)
 		}
 	}
@@ -134,20 +237,34 @@ func (w *Worker) updateTasks() {
 	tasks := w.GetTasks()
 	for _, t := range tasks {
 		if t.State == task.Running {
+			if t.DeadlineExceeded() {
+				logger.Warn("任务运行超过期限, 停止任务", "task_id", t.ID, "deadline_seconds", *t.ActiveDeadlineSeconds)
+				w.stopTask(*t, task.Failed, task.ReasonDeadlineExceeded)
+				continue
+			}
+
 			resp := w.InspectTask(*t)
 			if resp.Error != nil {
-				fmt.Printf("错误: %v\n", resp.Error)
+				logger.Warn("检视任务容器失败", "task_id", t.ID, "container_id", t.ContainerID, "error", resp.Error)
 			}
 
 			if resp.Container == nil {
-				log.Printf("该任务没有运行容器: %s\n", t.ID)
-				t.State = task.Failed
+				logger.Warn("任务没有运行容器", "task_id", t.ID)
+				_ = t.TransitionTo(task.Failed, "ContainerNotFound")
+				t.FinishTime = time.Now().UTC()
 				_ = w.Db.Put(t.ID.String(), t)
+				continue
 			}
 
+			// 容器以 0 退出时任务完成, 否则任务失败
 			if resp.Container.State.Status == "exited" {
-				log.Printf("该任务 %s 容器没有运行,状态: %s\n", t.ID, resp.Container.State.Status)
-				t.State = task.Failed
+				logger.Info("任务容器已退出", "task_id", t.ID, "container_id", t.ContainerID, "exit_code", resp.Container.State.ExitCode)
+				if code := resp.Container.State.ExitCode; code == 0 {
+					_ = t.TransitionTo(task.Completed, "")
+				} else {
+					_ = t.TransitionTo(task.Failed, fmt.Sprintf("ContainerExited: 退出码 %d", code))
+				}
+				t.FinishTime = time.Now().UTC()
 				_ = w.Db.Put(t.ID.String(), t)
 			}
 
@@ -157,41 +274,233 @@ func (w *Worker) updateTasks() {
 	}
 }
 
-func (w *Worker) StartTask(t task.Task) task.DockerResult {
+func (w *Worker) StartTask(ctx context.Context, t task.Task) task.DockerResult {
 	t.StartTime = time.Now().UTC()
 	config := task.NewConfig(&t)
+	config.Labels[task.LabelWorker] = w.Name
+	if id, ok := strings.CutPrefix(t.NetworkMode, task.NetworkModeTask); ok {
+		networkMode, err := w.containerNetworkMode(id)
+		if err != nil {
+			return w.failTask(t, "NetworkUnavailable", err)
+		}
+		config.NetworkMode = networkMode
+	}
 	d := task.NewDocker(config)
+
+	_ = t.TransitionTo(task.Pulling, "")
+	_ = w.Db.Put(t.ID.String(), &t)
+	_, span := tracer.Start(ctx, "docker.pull", trace.WithAttributes(attribute.String("image", t.Image)))
+	pulled := d.Pull()
+	tracing.RecordError(span, pulled.Error)
+	span.End()
+	if pulled.Error != nil {
+		return w.failTask(t, "ImagePullFailed", pulled.Error)
+	}
+
+	_ = t.TransitionTo(task.Starting, "")
+	_ = w.Db.Put(t.ID.String(), &t)
+	for _, ic := range t.InitContainers {
+		_, span := tracer.Start(ctx, "docker.run_init", trace.WithAttributes(attribute.String("init_container", ic.Name)))
+		code, err := d.RunInit(ic)
+		if err == nil && code != 0 {
+			err = fmt.Errorf("退出码 %d", code)
+		}
+		tracing.RecordError(span, err)
+		span.End()
+		if err != nil {
+			return w.failTask(t, "InitContainerFailed", fmt.Errorf("初始化容器 %s 失败: %v", ic.Name, err))
+		}
+	}
+
+	_, span = tracer.Start(ctx, "docker.run")
 	result := d.Run()
+	tracing.RecordError(span, result.Error)
+	span.End()
 	if result.Error != nil {
-		log.Printf("运行任务失败, 任务: %v, 错误: %v\n", t.ID, result.Error)
-		t.State = task.Failed
-		_ = w.Db.Put(t.ID.String(), &t)
+		w.failTask(t, "ContainerStartFailed", result.Error)
 		return result
 	}
-
 	t.ContainerID = result.ContainerId
-	t.State = task.Running
+
+	if t.PostStart != nil {
+		_, span := tracer.Start(ctx, "docker.post_start")
+		err := d.RunHook(t.ContainerID, t.PostStart)
+		tracing.RecordError(span, err)
+		span.End()
+		if err != nil {
+			d.Stop(t.ContainerID)
+			return w.failTask(t, "PostStartHookFailed", err)
+		}
+	}
+
+	_ = t.TransitionTo(task.Running, "")
+	t.Reason = ""
 	_ = w.Db.Put(t.ID.String(), &t)
 
 	return result
 }
 
+func (w *Worker) failTask(t task.Task, reason string, err error) task.DockerResult {
+	logger.Error("运行任务失败", "task_id", t.ID, "reason", reason, "error", err)
+	if terr := t.TransitionTo(task.Failed, fmt.Sprintf("%s: %v", reason, err)); terr != nil {
+		logger.Warn("更新任务状态失败", "task_id", t.ID, "error", terr)
+	}
+	t.FinishTime = time.Now().UTC()
+	_ = w.Db.Put(t.ID.String(), &t)
+	return task.DockerResult{Error: err}
+}
+
+// containerNetworkMode 返回共享任务 id 所在容器网络命名空间的 docker 网络模式
+func (w *Worker) containerNetworkMode(id string) (string, error) {
+	result, err := w.Db.Get(id)
+	if err != nil {
+		return "", fmt.Errorf("共享网络的任务 %s 不存在", id)
+	}
+	t := result.(*task.Task)
+	if t.State != task.Running || t.ContainerID == "" {
+		return "", fmt.Errorf("共享网络的任务 %s 未运行", id)
+	}
+	return fmt.Sprintf("container:%s", t.ContainerID), nil
+}
+
 func (w *Worker) StopTask(t task.Task) task.DockerResult {
+	return w.stopTask(t, task.Completed, "")
+}
+
+// stopTask 停止任务容器, 任务最终转换到 state 状态
+func (w *Worker) stopTask(t task.Task, state task.State, reason string) task.DockerResult {
 	config := task.NewConfig(&t)
 	d := task.NewDocker(config)
 
+	// 等待容器退出期间任务处于 Stopping 状态
+	_ = t.TransitionTo(task.Stopping, reason)
+	_ = w.Db.Put(t.ID.String(), &t)
+
+	// 拉取镜像或者启动期间 (例如 worker 重启前) 还没有创建容器, 直接转换到结束状态
+	if t.ContainerID == "" {
+		t.FinishTime = time.Now().UTC()
+		_ = t.TransitionTo(state, reason)
+		_ = w.Db.Put(t.ID.String(), &t)
+		logger.Info("任务没有容器, 直接结束", "task_id", t.ID, "state", t.State)
+		return task.DockerResult{Action: "stop", Result: "success"}
+	}
+
+	// preStop 钩子失败时只记录日志, 仍然停止容器, 任务保持请求的结束状态
+	if t.PreStop != nil {
+		if err := d.RunHook(t.ContainerID, t.PreStop); err != nil {
+			logger.Warn("preStop 钩子失败, 继续停止容器", "task_id", t.ID, "error", err)
+		}
+	}
+
 	result := d.Stop(t.ContainerID)
 	if result.Error != nil {
-		log.Printf("停止容器失败, 容器: %v, 错误: %v\n", t.ContainerID, result.Error)
+		logger.Error("停止容器失败", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
 	}
 	t.FinishTime = time.Now().UTC()
-	t.State = task.Completed
+	_ = t.TransitionTo(state, reason)
+	if w.Retention == 0 && result.Error == nil {
+		w.removeContainer(d, &t)
+	}
 	_ = w.Db.Put(t.ID.String(), &t)
-	log.Printf("停止并移除容器: %v, 任务: %v\n", t.ContainerID, t.ID)
+	logger.Info("停止容器", "task_id", t.ID, "container_id", t.ContainerID, "state", t.State)
 
 	return result
 }
 
+func (w *Worker) removeContainer(d *task.Docker, t *task.Task) {
+	if result := d.Remove(t.ContainerID); result.Error != nil {
+		logger.Error("移除容器失败", "task_id", t.ID, "container_id", t.ContainerID, "error", result.Error)
+		return
+	}
+	t.ContainerRemoved = true
+	logger.Info("移除容器", "task_id", t.ID, "container_id", t.ContainerID)
+}
+
+// removeExpiredContainers 移除结束时间超过保留时间的任务容器
+func (w *Worker) removeExpiredContainers() {
+	for _, t := range w.GetTasks() {
+		if t.State != task.Completed && t.State != task.Failed {
+			continue
+		}
+		if t.ContainerID == "" || t.ContainerRemoved || time.Since(t.FinishTime) < w.Retention {
+			continue
+		}
+		w.removeContainer(task.NewDocker(task.NewConfig(t)), t)
+		_ = w.Db.Put(t.ID.String(), t)
+	}
+}
+
+// removeOrphanedContainers 移除本节点创建但任务记录已经不存在的容器, 例如使用内存存储的 worker 重启之前创建的容器
+func (w *Worker) removeOrphanedContainers() {
+	d := task.NewDocker(&task.Config{})
+	containers, err := d.ListContainers(map[string]string{task.LabelWorker: w.Name})
+	if err != nil {
+		logger.Warn("列出任务容器失败", "error", err)
+		return
+	}
+	for _, c := range containers {
+		id := c.Labels[task.LabelTaskID]
+		if _, err := w.Db.Get(id); err == nil {
+			continue
+		}
+		logger.Warn("移除孤立的任务容器", "task_id", id, "task_name", c.Labels[task.LabelTaskName], "container_id", c.ID)
+		if c.State == "running" {
+			d.Stop(c.ID)
+		}
+		d.Remove(c.ID)
+	}
+}
+
+// RemoveVolume 移除挂载该卷的已结束任务保留的容器后删除 docker 卷, 仍有任务使用该卷时返回错误
+func (w *Worker) RemoveVolume(name string) error {
+	for _, t := range w.GetTasks() {
+		if !mountsVolume(t, name) {
+			continue
+		}
+		if t.State != task.Completed && t.State != task.Failed {
+			return fmt.Errorf("存储卷 %s 仍被任务 %s 使用, 状态: %v", name, t.ID, t.State)
+		}
+		if t.ContainerID != "" && !t.ContainerRemoved {
+			w.removeContainer(task.NewDocker(task.NewConfig(t)), t)
+			_ = w.Db.Put(t.ID.String(), t)
+			if !t.ContainerRemoved {
+				return fmt.Errorf("移除任务 %s 的容器失败", t.ID)
+			}
+		}
+	}
+	if err := task.NewDocker(&task.Config{}).RemoveVolume(name); err != nil {
+		return err
+	}
+	logger.Info("删除存储卷", "volume", name)
+	return nil
+}
+
+func mountsVolume(t *task.Task, name string) bool {
+	for _, m := range t.Mounts {
+		if m.Volume == name {
+			return true
+		}
+	}
+	return false
+}
+
+// PurgeTask 移除已结束任务保留的容器并删除任务记录
+func (w *Worker) PurgeTask(id string) error {
+	result, err := w.Db.Get(id)
+	if err != nil {
+		return err
+	}
+	t := result.(*task.Task)
+	if t.State != task.Completed && t.State != task.Failed {
+		return fmt.Errorf("任务 %s 尚未结束, 状态: %v", id, t.State)
+	}
+	if t.ContainerID != "" && !t.ContainerRemoved {
+		w.removeContainer(task.NewDocker(task.NewConfig(t)), t)
+	}
+	logger.Info("删除任务记录", "task_id", id)
+	return w.Db.Delete(id)
+}
+
 func (w *Worker) InspectTask(t task.Task) task.DockerInspectResponse {
 	config := task.NewConfig(&t)
 	d := task.NewDocker(config)